@@ -0,0 +1,154 @@
+// Package auth authenticates requests with API keys or signed JWT
+// bearer tokens and carries the authenticated principal in the request
+// context.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/problem"
+	"github.com/pkg/errors"
+)
+
+// Roles known to the API.
+const (
+	RoleAdmin   = "admin"
+	RolePartner = "partner"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+	Method  string   `json:"method"` // "api_key" or "jwt"
+}
+
+// HasRole reports whether the principal has a role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator checks the credentials of each request.
+type Authenticator struct {
+	Realm   string
+	APIKeys map[string]*Principal // API key -> principal
+	JWTKeys [][]byte              // HS256 keys, any of them may have signed a token
+	Issuer  string                // required "iss" claim, if set
+	Now     func() time.Time
+}
+
+// New returns an authenticator with no credentials configured.
+func New(realm string) *Authenticator {
+	return &Authenticator{
+		Realm:   realm,
+		APIKeys: make(map[string]*Principal),
+		Now:     time.Now,
+	}
+}
+
+// AddAPIKey registers an API key for a subject with the given roles.
+func (a *Authenticator) AddAPIKey(key string, subject string, roles ...string) {
+	a.APIKeys[key] = &Principal{Subject: subject, Roles: roles, Method: "api_key"}
+}
+
+// ParseAPIKey parses an API key definition of the form
+// "key=subject:role1,role2" and registers it.
+func (a *Authenticator) ParseAPIKey(def string) error {
+	parts := strings.SplitN(def, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("invalid API key definition, expected key=subject:roles")
+	}
+	subject, roles := parts[1], ""
+	if i := strings.IndexByte(subject, ':'); i >= 0 {
+		subject, roles = subject[:i], subject[i+1:]
+	}
+	if subject == "" {
+		return errors.New("API key definition has no subject")
+	}
+	var list []string
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			list = append(list, role)
+		}
+	}
+	a.AddAPIKey(parts[0], subject, list...)
+	return nil
+}
+
+// Authenticate returns the principal for the credentials of a request.
+// It returns nil and no error when the request carries no credentials.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		const prefix = "Bearer "
+		if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+			return nil, errors.New("unsupported authorization scheme")
+		}
+		return a.verifyToken(strings.TrimSpace(h[len(prefix):]))
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.lookupAPIKey(key)
+	}
+	return nil, nil
+}
+
+// lookupAPIKey finds the principal for an API key, comparing keys in
+// constant time.
+func (a *Authenticator) lookupAPIKey(key string) (*Principal, error) {
+	var found *Principal
+	for k, p := range a.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = p
+		}
+	}
+	if found == nil {
+		return nil, errors.New("invalid API key")
+	}
+	return found, nil
+}
+
+// Handler is a middleware that authenticates each request and stores
+// the principal in the request context. Requests without credentials
+// pass through anonymously, requests with bad credentials get a 401.
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			a.Challenge(w, r, err.Error())
+			return
+		}
+		if p != nil {
+			r = r.WithContext(NewContext(r.Context(), p))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Challenge writes a 401 asking the client to authenticate.
+func (a *Authenticator) Challenge(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, a.Realm))
+	problem.Render(w, r, http.StatusUnauthorized, detail)
+}
+
+// key is the context key for the principal.
+type key struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, key{}, p)
+}
+
+// FromContext returns the authenticated principal of a request.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(key{}).(*Principal)
+	return p, ok
+}
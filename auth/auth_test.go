@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthenticate(t *testing.T) {
+	Convey("Given an authenticator with API keys and a JWT key", t, func() {
+		now := time.Unix(1500000000, 0)
+		a := New("test")
+		a.Now = func() time.Time { return now }
+		a.JWTKeys = [][]byte{[]byte("old"), []byte("current")}
+		So(a.ParseAPIKey("k1=ops:admin,reader"), ShouldBeNil)
+		So(a.ParseAPIKey("k2=intuit"), ShouldBeNil)
+		So(a.ParseAPIKey("nosubject"), ShouldNotBeNil)
+
+		request := func(header, value string) *http.Request {
+			r := httptest.NewRequest("GET", "/admin", nil)
+			if header != "" {
+				r.Header.Set(header, value)
+			}
+			return r
+		}
+
+		Convey("API keys resolve to their principal", func() {
+			p, err := a.Authenticate(request("X-API-Key", "k1"))
+			So(err, ShouldBeNil)
+			So(p.Subject, ShouldEqual, "ops")
+			So(p.HasRole(RoleAdmin), ShouldBeTrue)
+
+			p, err = a.Authenticate(request("X-API-Key", "k2"))
+			So(err, ShouldBeNil)
+			So(p.HasRole(RoleAdmin), ShouldBeFalse)
+
+			_, err = a.Authenticate(request("X-API-Key", "nope"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Signed bearer tokens resolve to their principal", func() {
+			token, err := a.Sign("alice", []string{RoleAdmin}, time.Hour)
+			So(err, ShouldBeNil)
+
+			p, err := a.Authenticate(request("Authorization", "Bearer "+token))
+			So(err, ShouldBeNil)
+			So(p.Subject, ShouldEqual, "alice")
+			So(p.Method, ShouldEqual, "jwt")
+			So(p.HasRole(RoleAdmin), ShouldBeTrue)
+		})
+
+		Convey("Bad tokens are rejected", func() {
+			expired, _ := a.Sign("alice", nil, -time.Hour)
+			other := New("test")
+			other.Now = a.Now
+			other.JWTKeys = [][]byte{[]byte("someone else")}
+			forged, _ := other.Sign("alice", []string{RoleAdmin}, time.Hour)
+
+			for _, h := range []string{"Bearer " + expired, "Bearer " + forged, "Bearer abc", "Basic YWxpY2U6"} {
+				_, err := a.Authenticate(request("Authorization", h))
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("The middleware puts the principal on the context", func() {
+			var got *Principal
+			h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = FromContext(r.Context())
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request("X-API-Key", "k1"))
+			So(got.Subject, ShouldEqual, "ops")
+
+			got = nil
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, request("", ""))
+			So(got, ShouldBeNil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, request("X-API-Key", "nope"))
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(w.Header().Get("WWW-Authenticate"), ShouldEqual, `Bearer realm="test"`)
+		})
+	})
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/database"
+	"github.com/dstroot/chi_api/logging"
+	"github.com/dstroot/chi_api/ratelimit"
+	"github.com/dstroot/chi_api/tiering"
+	"github.com/dstroot/chi_api/validation"
+	env "github.com/joeshaw/envdecode"
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+)
+
+// processEnv holds the variables the process was started with, which
+// win over the .env file at startup and on reload.
+var processEnv map[string]bool
+
+// secretFiles holds the variables we set from *_FILE secrets, so a
+// reload may set them again.
+var secretFiles = make(map[string]bool)
+
+// dotEnv holds the variables we set from the .env file, so a reload
+// can unset those removed from it.
+var dotEnv = make(map[string]bool)
+
+// loadDotEnv sets the variables of the .env file, if there is one,
+// that neither the process environment nor a *_FILE secret sets, and
+// unsets those it set before that the file no longer has.
+func loadDotEnv(filenames ...string) error {
+	if processEnv == nil {
+		processEnv = make(map[string]bool)
+		for _, kv := range os.Environ() {
+			processEnv[strings.SplitN(kv, "=", 2)[0]] = true
+		}
+	}
+	vars, err := godotenv.Read(filenames...)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return errors.Wrap(err, "reading .env")
+	}
+	for k := range dotEnv {
+		if _, ok := vars[k]; !ok && !processEnv[k] && !secretFiles[k] {
+			os.Unsetenv(k)
+			delete(dotEnv, k)
+		}
+	}
+	for k, v := range vars {
+		if !processEnv[k] && !secretFiles[k] {
+			os.Setenv(k, v)
+			dotEnv[k] = true
+		}
+	}
+	return nil
+}
+
+// loadConfig reads the configuration from env variables, after setting
+// those given as *_FILE secrets, and validates it.
+func loadConfig(c *Config) error {
+	err := loadSecretFiles(envNames(reflect.TypeOf(*c)))
+	if err != nil {
+		return err
+	}
+	err = env.Decode(c)
+	if err != nil {
+		return errors.Wrap(err, "configuration decode failed")
+	}
+	return errors.Wrap(validateConfig(c), "invalid configuration")
+}
+
+// loadSecretFiles sets each variable NAME whose NAME_FILE is set to the
+// contents of that file, e.g. a Docker or Kubernetes secret. Setting
+// both a non-empty NAME and NAME_FILE is an error.
+func loadSecretFiles(names []string) error {
+	for _, name := range names {
+		path := os.Getenv(name + "_FILE")
+		if path == "" {
+			continue
+		}
+		if os.Getenv(name) != "" && !secretFiles[name] {
+			return errors.Errorf("both %s and %s_FILE are set", name, name)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s_FILE", name)
+		}
+		os.Setenv(name, strings.TrimRight(string(b), "\r\n"))
+		secretFiles[name] = true
+	}
+	return nil
+}
+
+// envNames returns the env variables read into the fields of t.
+func envNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type.PkgPath() == "" {
+			names = append(names, envNames(f.Type)...)
+			continue
+		}
+		if tag := f.Tag.Get("env"); tag != "" {
+			names = append(names, strings.SplitN(tag, ",", 2)[0])
+		}
+	}
+	return names
+}
+
+// redactedConfig returns a copy of the configuration that is safe to
+// log.
+func redactedConfig() Config {
+	c := cfg
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// redact replaces the values of the fields tagged secret:"true" in v.
+// Slices are replaced rather than changed in place as they share their
+// elements with the original.
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		f, field := v.Field(i), v.Type().Field(i)
+		switch {
+		case f.Kind() == reflect.Struct:
+			redact(f)
+		case field.Tag.Get("secret") != "true":
+		case f.Kind() == reflect.String && f.Len() > 0:
+			f.SetString(database.Redacted)
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+			redacted := make([]string, f.Len())
+			for j := range redacted {
+				redacted[j] = database.Redacted
+			}
+			f.Set(reflect.ValueOf(redacted))
+		}
+	}
+}
+
+// validateConfig reports configuration we can't serve with.
+func validateConfig(c *Config) error {
+	var errs validation.Errors
+	if c.Storage != "mssql" && c.Storage != "memory" {
+		errs.Add("STORAGE", "must be mssql or memory")
+	}
+	if _, err := strconv.Atoi(c.Port); err != nil {
+		errs.Add("PORT", "must be a number")
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs.Add("LOG_FORMAT", "must be json or text")
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs.Add("LOG_LEVEL", "must be debug, info, warn or error")
+	}
+	notNegative(&errs, "SERVER_READ_TIMEOUT", c.Server.ReadTimeout)
+	notNegative(&errs, "SERVER_READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout)
+	notNegative(&errs, "SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout)
+	notNegative(&errs, "SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout)
+	if c.Server.RequestTimeout <= 0 {
+		errs.Add("SERVER_REQUEST_TIMEOUT", "must be positive")
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		errs.Add("SERVER_MAX_HEADER_BYTES", "must be positive")
+	}
+	notNegative(&errs, "SERVER_DRAIN_DELAY", c.Server.DrainDelay)
+	notNegative(&errs, "SERVER_SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout)
+	if c.Storage == "mssql" {
+		validateSQL(&errs, c)
+	}
+	if u, err := url.Parse(c.GiactURL); err != nil || !u.IsAbs() {
+		errs.Add("GIACT_URL", "must be an absolute URL")
+	}
+	if c.GiactTimeout <= 0 || c.GiactTimeout >= c.Server.RequestTimeout {
+		// otherwise slow verifications end as our own timeout rather
+		// than as GIACT being unavailable
+		errs.Add("GIACT_TIMEOUT", "must be positive and shorter than SERVER_REQUEST_TIMEOUT")
+	}
+	if c.HealthTimeout <= 0 {
+		errs.Add("HEALTH_CHECK_TIMEOUT", "must be positive")
+	}
+	if c.Page.MaxLimit < 1 {
+		errs.Add("PAGE_MAX_LIMIT", "must be positive")
+	}
+	if c.Page.DefaultLimit < 1 || c.Page.DefaultLimit > c.Page.MaxLimit {
+		errs.Add("PAGE_DEFAULT_LIMIT", "must be between 1 and PAGE_MAX_LIMIT")
+	}
+	if c.Page.MaxOffset < 0 {
+		errs.Add("PAGE_MAX_OFFSET", "must not be negative")
+	}
+	validateTaxPro(&errs, c)
+	if _, err := ratelimit.ParseLimits(c.RateLimit.Limits); err != nil {
+		errs.Add("RATE_LIMITS", "%v", err)
+	}
+	return errs.Err()
+}
+
+// validateSQL checks the SQL Server settings.
+func validateSQL(errs *validation.Errors, c *Config) {
+	if c.SQL.Host == "" {
+		errs.Add("MSSQL_HOST", "is required")
+	}
+	if _, err := strconv.Atoi(c.SQL.Port); err != nil {
+		errs.Add("MSSQL_PORT", "must be a number")
+	}
+	switch c.SQL.Encrypt {
+	case "", "true", "false", "disable":
+	default:
+		errs.Add("MSSQL_ENCRYPT", "must be true, false or disable")
+	}
+	if c.SQL.Certificate != "" {
+		if _, err := os.Stat(c.SQL.Certificate); err != nil {
+			errs.Add("MSSQL_CERTIFICATE", "must be a readable file")
+		}
+	}
+	notNegative(errs, "MSSQL_CONNECTION_TIMEOUT", c.SQL.ConnectionTimeout)
+	notNegative(errs, "MSSQL_DIAL_TIMEOUT", c.SQL.DialTimeout)
+	notNegative(errs, "MSSQL_KEEPALIVE", c.SQL.KeepAlive)
+	notNegative(errs, "MSSQL_QUERY_TIMEOUT", c.SQL.QueryTimeout)
+	notNegative(errs, "MSSQL_CONN_MAX_LIFETIME", c.SQL.ConnMaxLifetime)
+	if c.SQL.MaxOpenConns < 0 {
+		errs.Add("MSSQL_MAX_OPEN_CONNS", "must not be negative")
+	}
+	if c.SQL.MaxIdleConns < 0 {
+		errs.Add("MSSQL_MAX_IDLE_CONNS", "must not be negative")
+	}
+}
+
+// validateTaxPro checks the tax professional lookup settings.
+func validateTaxPro(errs *validation.Errors, c *Config) {
+	if c.TaxPro.MaxLookupBatch < 1 {
+		errs.Add("TAXPRO_MAX_LOOKUP_BATCH", "must be positive")
+	}
+	rules, err := tiering.ParseRules(c.TaxPro.Tiers)
+	if err != nil {
+		errs.Add("TAXPRO_TIERS", "%v", err)
+	}
+	overrides, err := tiering.ParseOverrides(c.TaxPro.TierOverrides)
+	if err != nil {
+		errs.Add("TAXPRO_TIER_OVERRIDES", "%v", err)
+	}
+	if rules != nil && overrides != nil {
+		if _, err := tiering.New(rules, overrides, c.TaxPro.PremierTier); err != nil {
+			errs.Add("TAXPRO_PREMIER_TIER", "%v", err)
+		}
+	}
+	if c.TaxPro.LastYear != 0 && c.TaxPro.LastYear < c.TaxPro.FirstYear {
+		errs.Add("TAXPRO_LAST_YEAR", "must not be before TAXPRO_FIRST_YEAR")
+	}
+	notNegative(errs, "TAXPRO_CACHE_TTL", c.TaxPro.CacheTTL)
+	notNegative(errs, "TAXPRO_CACHE_CURRENT_TTL", c.TaxPro.CacheCurrentTTL)
+	notNegative(errs, "TAXPRO_CACHE_NOT_FOUND_TTL", c.TaxPro.CacheNotFoundTTL)
+	if c.TaxPro.CacheSize < 0 {
+		errs.Add("TAXPRO_CACHE_SIZE", "must not be negative")
+	}
+}
+
+// notNegative checks that a duration isn't negative.
+func notNegative(errs *validation.Errors, field string, d time.Duration) {
+	if d < 0 {
+		errs.Add(field, "must not be negative")
+	}
+}
+
+// reload re-reads the .env file, the *_FILE secrets and the env
+// variables. Only the log level and the rate limits change while we
+// run: other settings need a restart.
+func reload() error {
+	err := loadDotEnv()
+	if err != nil {
+		return err
+	}
+
+	var c Config
+	if err = loadConfig(&c); err != nil {
+		return err
+	}
+	level, _ := logging.ParseLevel(c.Log.Level)
+	limits, _ := ratelimit.ParseLimits(c.RateLimit.Limits)
+
+	logger.SetLevel(level)
+	limiter.SetLimits(limits)
+	logger.Info("configuration reloaded", "level", level, "rate_limits", c.RateLimit.Limits)
+	return nil
+}
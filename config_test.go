@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dstroot/chi_api/database"
+	"github.com/dstroot/chi_api/validation"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedactedConfig(t *testing.T) {
+	Convey("Secrets are redacted from the configuration dump", t, func() {
+		saved := cfg
+		defer func() { cfg = saved }()
+		cfg.SQL.Password = "hunter2"
+		cfg.GiactAuthIntuit = "Basic abc"
+		cfg.Auth.JWTKeys = []string{"k1", "k2"}
+		cfg.SQL.User = "admin"
+
+		c := redactedConfig()
+		So(c.SQL.Password, ShouldEqual, database.Redacted)
+		So(c.GiactAuthIntuit, ShouldEqual, database.Redacted)
+		So(c.Auth.JWTKeys, ShouldResemble, []string{database.Redacted, database.Redacted})
+		So(c.SQL.User, ShouldEqual, "admin")
+		So(cfg.Auth.JWTKeys, ShouldResemble, []string{"k1", "k2"})
+	})
+}
+
+func TestSecretFiles(t *testing.T) {
+	Convey("Given a secret file", t, func() {
+		dir, err := ioutil.TempDir("", "secrets")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "password")
+		So(ioutil.WriteFile(path, []byte("s3cret\n"), 0600), ShouldBeNil)
+
+		os.Unsetenv("TEST_SECRET")
+		os.Setenv("TEST_SECRET_FILE", path)
+		defer os.Unsetenv("TEST_SECRET_FILE")
+		defer os.Unsetenv("TEST_SECRET")
+		defer delete(secretFiles, "TEST_SECRET")
+
+		Convey("Its contents set the variable, again on reload", func() {
+			So(loadSecretFiles([]string{"TEST_SECRET"}), ShouldBeNil)
+			So(os.Getenv("TEST_SECRET"), ShouldEqual, "s3cret")
+			So(loadSecretFiles([]string{"TEST_SECRET"}), ShouldBeNil)
+		})
+
+		Convey("Setting the variable too is an error", func() {
+			os.Setenv("TEST_SECRET", "plain")
+			So(loadSecretFiles([]string{"TEST_SECRET"}), ShouldNotBeNil)
+		})
+
+		Convey("A missing file is an error", func() {
+			os.Setenv("TEST_SECRET_FILE", filepath.Join(dir, "nope"))
+			So(loadSecretFiles([]string{"TEST_SECRET"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("The env names include nested settings", t, func() {
+		var c Config
+		names := envNames(reflect.TypeOf(c))
+		So(names, ShouldContain, "MSSQL_PASSWORD")
+		So(names, ShouldContain, "GIACT_AUTH_INTUIT")
+		So(names, ShouldContain, "RATE_LIMITS")
+	})
+}
+
+func TestDotEnv(t *testing.T) {
+	Convey("Given a .env file", t, func() {
+		dir, err := ioutil.TempDir("", "dotenv")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, ".env")
+		So(ioutil.WriteFile(path, []byte("TEST_REAL=dotenv\nTEST_DOTENV=dotenv\n"), 0600), ShouldBeNil)
+
+		saved := processEnv
+		defer func() { processEnv = saved }()
+		processEnv = map[string]bool{"TEST_REAL": true}
+		os.Setenv("TEST_REAL", "process")
+		defer os.Unsetenv("TEST_REAL")
+		defer os.Unsetenv("TEST_DOTENV")
+
+		Convey("The process environment wins, again on reload", func() {
+			So(loadDotEnv(path), ShouldBeNil)
+			So(os.Getenv("TEST_REAL"), ShouldEqual, "process")
+			So(os.Getenv("TEST_DOTENV"), ShouldEqual, "dotenv")
+
+			So(ioutil.WriteFile(path, []byte("TEST_REAL=changed\nTEST_DOTENV=changed\n"), 0600), ShouldBeNil)
+			So(loadDotEnv(path), ShouldBeNil)
+			So(os.Getenv("TEST_REAL"), ShouldEqual, "process")
+			So(os.Getenv("TEST_DOTENV"), ShouldEqual, "changed")
+		})
+
+		Convey("Variables removed from the file are unset on reload", func() {
+			So(loadDotEnv(path), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte("TEST_REAL=changed\n"), 0600), ShouldBeNil)
+			So(loadDotEnv(path), ShouldBeNil)
+			So(os.Getenv("TEST_REAL"), ShouldEqual, "process")
+			_, ok := os.LookupEnv("TEST_DOTENV")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("A missing file is fine", func() {
+			So(loadDotEnv(filepath.Join(dir, "nope")), ShouldBeNil)
+		})
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	Convey("Given a valid configuration", t, func() {
+		var c Config
+		So(loadConfig(&c), ShouldBeNil)
+		c.Storage = "memory"
+		So(validateConfig(&c), ShouldBeNil)
+
+		Convey("Each bad setting is reported", func() {
+			c.Port = "http"
+			c.Log.Level = "loud"
+			c.RateLimit.Limits = []string{"*:*=0/m"}
+			c.TaxPro.PremierTier = "Platinum"
+			err := validateConfig(&c)
+			So(err, ShouldNotBeNil)
+
+			var fields []string
+			for _, e := range err.(validation.Errors) {
+				fields = append(fields, e.Field)
+			}
+			So(fields, ShouldResemble, []string{"PORT", "LOG_LEVEL", "TAXPRO_PREMIER_TIER", "RATE_LIMITS"})
+		})
+
+		Convey("GIACT must time out before the request does", func() {
+			c.GiactTimeout = c.Server.RequestTimeout
+			err := validateConfig(&c)
+			So(err, ShouldNotBeNil)
+			So(err.(validation.Errors)[0].Field, ShouldEqual, "GIACT_TIMEOUT")
+		})
+	})
+}
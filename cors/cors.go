@@ -0,0 +1,160 @@
+// Package cors implements Cross-Origin Resource Sharing so the partner
+// front-ends can call the API from the browser.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/problem"
+)
+
+// Options is a CORS policy.
+type Options struct {
+	AllowedOrigins   []string // "*" allows any origin
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // how long preflight results may be cached
+}
+
+// allowsOrigin reports whether the policy allows an origin.
+func (o *Options) allowsOrigin(origin string) bool {
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether the policy allows a method.
+func (o *Options) allowsMethod(method string) bool {
+	for _, allowed := range o.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether the policy allows every header in a
+// comma separated Access-Control-Request-Headers value.
+func (o *Options) allowsHeaders(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		found := false
+		for _, allowed := range o.AllowedHeaders {
+			if allowed == "*" || strings.EqualFold(allowed, h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Policy applies a default CORS policy, with overrides for specific
+// path prefixes such as /admin.
+type Policy struct {
+	defaults  *Options
+	overrides map[string]*Options
+}
+
+// New returns a policy that applies opts to every route.
+func New(opts Options) *Policy {
+	return &Policy{defaults: &opts, overrides: make(map[string]*Options)}
+}
+
+// Override applies opts instead of the defaults to every path under prefix.
+func (p *Policy) Override(prefix string, opts Options) *Policy {
+	p.overrides[strings.TrimSuffix(prefix, "/")] = &opts
+	return p
+}
+
+// options returns the options for a request path, preferring the
+// longest matching override.
+func (p *Policy) options(path string) *Options {
+	match, opts := "", p.defaults
+	for prefix, o := range p.overrides {
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > len(match) {
+			match, opts = prefix, o
+		}
+	}
+	return opts
+}
+
+// Handler is the CORS middleware. It answers preflight requests itself
+// and adds the CORS response headers to actual requests from allowed
+// origins.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		opts := p.options(r.URL.Path)
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			preflight(w, r, opts, origin)
+			return
+		}
+
+		if opts.allowsOrigin(origin) {
+			allowOrigin(w, opts, origin)
+			if len(opts.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight answers a preflight request. A disallowed request gets no
+// CORS headers, which makes the browser block the actual request.
+func preflight(w http.ResponseWriter, r *http.Request, opts *Options, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	headers := r.Header.Get("Access-Control-Request-Headers")
+	if !opts.allowsOrigin(origin) || !opts.allowsMethod(method) || !opts.allowsHeaders(headers) {
+		problem.Render(w, r, http.StatusForbidden, "cross-origin request not allowed")
+		return
+	}
+
+	allowOrigin(w, opts, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+	if headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	if opts.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowOrigin sets the allowed origin. Credentialed requests can't use
+// a wildcard, so the request origin is echoed back.
+func allowOrigin(w http.ResponseWriter, opts *Options, origin string) {
+	if len(opts.AllowedOrigins) == 1 && opts.AllowedOrigins[0] == "*" && !opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
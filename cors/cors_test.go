@@ -0,0 +1,97 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Given a policy for the partner sites with an /admin override", t, func() {
+		policy := New(Options{
+			AllowedOrigins: []string{"http://localhost:3001", "http://localhost:3002/"},
+			AllowedMethods: []string{"GET", "POST"},
+			AllowedHeaders: []string{"Content-Type", "X-API-Key"},
+			ExposedHeaders: []string{"X-Request-Id"},
+			MaxAge:         10 * time.Minute,
+		}).Override("/admin", Options{
+			AllowedOrigins:   []string{"http://localhost:3001"},
+			AllowedMethods:   []string{"GET"},
+			AllowCredentials: true,
+		})
+
+		var served bool
+		h := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		}))
+		do := func(method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+			served = false
+			r := httptest.NewRequest(method, path, nil)
+			if origin != "" {
+				r.Header.Set("Origin", origin)
+			}
+			for k, v := range headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+
+		Convey("Preflights from an allowed origin are answered", func() {
+			w := do("OPTIONS", "/taxpro/2017/012345", "http://localhost:3002", map[string]string{
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, x-api-key",
+			})
+			So(served, ShouldBeFalse)
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "http://localhost:3002")
+			So(w.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, POST")
+			So(w.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "content-type, x-api-key")
+			So(w.Header().Get("Access-Control-Max-Age"), ShouldEqual, "600")
+		})
+
+		Convey("Preflights for disallowed origins, methods or headers are refused", func() {
+			for _, test := range []struct{ origin, method, headers string }{
+				{"http://evil.example.com", "GET", ""},
+				{"http://localhost:3001", "DELETE", ""},
+				{"http://localhost:3001", "GET", "X-Secret"},
+			} {
+				w := do("OPTIONS", "/articles", test.origin, map[string]string{
+					"Access-Control-Request-Method":  test.method,
+					"Access-Control-Request-Headers": test.headers,
+				})
+				So(w.Code, ShouldEqual, http.StatusForbidden)
+				So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "")
+			}
+		})
+
+		Convey("Actual requests get the allowed origin and exposed headers", func() {
+			w := do("GET", "/articles", "http://localhost:3001", nil)
+			So(served, ShouldBeTrue)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "http://localhost:3001")
+			So(w.Header().Get("Access-Control-Expose-Headers"), ShouldEqual, "X-Request-Id")
+			So(w.Header().Get("Vary"), ShouldEqual, "Origin")
+		})
+
+		Convey("The /admin override applies to admin routes", func() {
+			w := do("OPTIONS", "/admin/accounts", "http://localhost:3002", map[string]string{
+				"Access-Control-Request-Method": "GET",
+			})
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+
+			w = do("GET", "/admin/accounts", "http://localhost:3001", nil)
+			So(w.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "http://localhost:3001")
+		})
+
+		Convey("Requests without an Origin are passed through untouched", func() {
+			w := do("GET", "/articles", "", nil)
+			So(served, ShouldBeTrue)
+			So(w.Header().Get("Vary"), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Redacted replaces the password in connection strings we log.
+const Redacted = "REDACTED"
+
+// Options configure the connection to SQL Server and its pool.
+type Options struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+	AppName  string // shows as program_name in sys.dm_exec_sessions
+
+	// Encrypt is "true" to encrypt everything, "false" to encrypt only
+	// the login, or "disable" for no encryption. Empty leaves it to the
+	// driver.
+	Encrypt                string
+	TrustServerCertificate bool
+	Certificate            string // CA certificate file, empty for the system roots
+	HostNameInCertificate  string // empty for Host
+
+	ConnectionTimeout time.Duration
+	DialTimeout       time.Duration
+	KeepAlive         time.Duration // 0 to disable
+
+	MaxOpenConns    int           // 0 for no limit
+	MaxIdleConns    int           // 0 for database/sql's default of 2
+	ConnMaxLifetime time.Duration // 0 to reuse connections forever
+}
+
+// DSN returns the sqlserver:// connection URL for o. Every part is
+// escaped, so passwords may hold any character, ";" included.
+func (o Options) DSN() string {
+	return o.url(url.UserPassword(o.User, o.Password))
+}
+
+// Redacted returns the DSN with the password replaced, for logging.
+func (o Options) Redacted() string {
+	return o.url(url.UserPassword(o.User, Redacted))
+}
+
+func (o Options) url(user *url.Userinfo) string {
+	q := url.Values{}
+	q.Set("database", o.Database)
+	if o.AppName != "" {
+		q.Set("app name", o.AppName)
+	}
+	if o.Encrypt != "" {
+		q.Set("encrypt", o.Encrypt)
+	}
+	if o.TrustServerCertificate {
+		q.Set("TrustServerCertificate", "true")
+	}
+	if o.Certificate != "" {
+		q.Set("certificate", o.Certificate)
+	}
+	if o.HostNameInCertificate != "" {
+		q.Set("hostNameInCertificate", o.HostNameInCertificate)
+	}
+	q.Set("connection timeout", seconds(o.ConnectionTimeout))
+	q.Set("dial timeout", seconds(o.DialTimeout))
+	q.Set("keepAlive", seconds(o.KeepAlive))
+
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     user,
+		Host:     o.Host,
+		RawQuery: q.Encode(),
+	}
+	if o.Port != "" {
+		u.Host = net.JoinHostPort(o.Host, o.Port)
+	}
+	return u.String()
+}
+
+// seconds formats d in whole seconds, as the driver expects.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(d / time.Second))
+}
+
+// Open opens a pool of connections configured by o. Like sql.Open it
+// doesn't connect.
+func Open(o Options) (*sql.DB, error) {
+	db, err := sql.Open("mssql", o.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(o.MaxOpenConns)
+	db.SetMaxIdleConns(o.MaxIdleConns)
+	db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	return db, nil
+}
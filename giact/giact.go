@@ -0,0 +1,204 @@
+// Package giact is a client for the GIACT gVerify bank account
+// verification service.
+package giact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InquiriesPath is the path of the inquiries endpoint relative to the
+// GIACT base URL.
+const InquiriesPath = "verificationservices/v5/inquiries"
+
+// AccountType is the type of a bank account.
+type AccountType int
+
+// Account types understood by GIACT.
+const (
+	Checking AccountType = 0
+	Savings  AccountType = 1
+)
+
+// Check identifies the bank account being verified.
+type Check struct {
+	RoutingNumber string      `json:"RoutingNumber"`
+	AccountNumber string      `json:"AccountNumber"`
+	AccountType   AccountType `json:"AccountType"`
+}
+
+// Customer is the account holder.
+type Customer struct {
+	FirstName    string `json:"FirstName,omitempty"`
+	LastName     string `json:"LastName,omitempty"`
+	BusinessName string `json:"BusinessName,omitempty"`
+}
+
+// Inquiry is an account verification request.
+type Inquiry struct {
+	UniqueID       string    `json:"UniqueId"`
+	Check          *Check    `json:"Check"`
+	Customer       *Customer `json:"Customer,omitempty"`
+	GVerifyEnabled bool      `json:"GVerifyEnabled"`
+}
+
+// VerificationResponse is GIACT's overall verdict on an inquiry.
+type VerificationResponse int
+
+// Verification responses returned by GIACT.
+const (
+	Error                VerificationResponse = 0
+	PrivateBadChecksList VerificationResponse = 1
+	Declined             VerificationResponse = 2
+	RejectItem           VerificationResponse = 3
+	AcceptWithRisk       VerificationResponse = 4
+	RiskAlert            VerificationResponse = 5
+	Pass                 VerificationResponse = 6
+	NegativeData         VerificationResponse = 7
+	NoData               VerificationResponse = 8
+)
+
+// AccountResponseCode is GIACT's finding on the account itself.
+type AccountResponseCode string
+
+// Account response codes returned by GIACT.
+const (
+	InvalidRoutingNumber AccountResponseCode = "GS01"
+	InvalidAccountNumber AccountResponseCode = "GS02"
+	InvalidCheckNumber   AccountResponseCode = "GS03"
+	InvalidAmount        AccountResponseCode = "GS04"
+	PrivateBadChecks     AccountResponseCode = "GP01" // on our private bad checks list
+	AccountDeclined      AccountResponseCode = "RT01"
+	AccountRejected      AccountResponseCode = "RT02"
+	CurrentNegativeData  AccountResponseCode = "RT03"
+	NonDemandDeposit     AccountResponseCode = "RT04" // e.g. a credit card or brokerage check
+	RecentNegativeData   AccountResponseCode = "RT05"
+	CheckingVerified     AccountResponseCode = "_1111"
+	AmexVerified         AccountResponseCode = "_2222"
+	NonParticipant       AccountResponseCode = "_3333" // positive data from a non-participant bank
+	SavingsVerified      AccountResponseCode = "_5555"
+	NoAccountData        AccountResponseCode = "ND00"
+	GovernmentRouting    AccountResponseCode = "ND01"
+)
+
+// Response is GIACT's reply to an Inquiry.
+type Response struct {
+	ItemReferenceID      int64                `json:"ItemReferenceId"`
+	CreatedDate          string               `json:"CreatedDate"`
+	VerificationResponse VerificationResponse `json:"VerificationResponse"`
+	AccountResponseCode  AccountResponseCode  `json:"AccountResponseCode"`
+	BankName             string               `json:"BankName"`
+	ErrorMessage         string               `json:"ErrorMessage"`
+}
+
+// Outcome is our own verdict on a bank account.
+type Outcome string
+
+// Outcomes of a verification.
+const (
+	OutcomePass   Outcome = "pass"
+	OutcomeFail   Outcome = "fail"
+	OutcomeReview Outcome = "review"
+)
+
+// Outcome maps GIACT's verification response and account response code
+// to pass, fail or review, whichever of the two is worse. Anything GIACT
+// could not positively verify or reject, including responses and codes
+// we don't know about, needs a manual review.
+func (resp *Response) Outcome() Outcome {
+	var outcome Outcome
+	switch resp.VerificationResponse {
+	case Pass:
+		outcome = OutcomePass
+	case PrivateBadChecksList, Declined, RejectItem, NegativeData:
+		return OutcomeFail
+	default:
+		outcome = OutcomeReview
+	}
+
+	switch resp.AccountResponseCode {
+	case "", CheckingVerified, AmexVerified, NonParticipant, SavingsVerified:
+		return outcome
+	case InvalidRoutingNumber, InvalidAccountNumber, InvalidCheckNumber, InvalidAmount,
+		PrivateBadChecks, AccountDeclined, AccountRejected, NonDemandDeposit:
+		return OutcomeFail
+	default:
+		return OutcomeReview
+	}
+}
+
+// Client calls the GIACT API with a single set of credentials.
+type Client struct {
+	BaseURL       string
+	Authorization string // value of the Authorization header, e.g. "Basic ..."
+	HTTPClient    *http.Client
+}
+
+// New returns a client for the GIACT API at baseURL.
+func New(baseURL string, authorization string, timeout time.Duration) *Client {
+	return &Client{
+		BaseURL:       baseURL,
+		Authorization: authorization,
+		HTTPClient:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Verify sends an account verification inquiry to GIACT.
+func (c *Client) Verify(ctx context.Context, inquiry *Inquiry) (*Response, error) {
+	body, err := json.Marshal(inquiry)
+	if err != nil {
+		return nil, errors.Wrap(err, "giact: encoding inquiry")
+	}
+
+	url := strings.TrimSuffix(c.BaseURL, "/") + "/" + InquiriesPath
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "giact: building request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", c.Authorization)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "giact: request failed")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return nil, errors.Errorf("giact: unexpected status %d: %s", res.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, errors.Wrap(err, "giact: decoding response")
+	}
+	if resp.VerificationResponse == Error {
+		return nil, errors.Errorf("giact: %s", resp.ErrorMessage)
+	}
+	return resp, nil
+}
+
+// Ping checks that the GIACT API can be reached. Any HTTP response
+// counts, only connection failures are errors.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequest("HEAD", c.BaseURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "giact: building request")
+	}
+	res, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "giact: unreachable")
+	}
+	res.Body.Close()
+	return nil
+}
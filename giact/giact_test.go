@@ -0,0 +1,143 @@
+package giact
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// standIn returns a GIACT stand-in server that answers every inquiry
+// with the given verification response.
+func standIn(verification VerificationResponse, got *Inquiry, auth *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+InquiriesPath {
+			http.NotFound(w, r)
+			return
+		}
+		*auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(got)
+		json.NewEncoder(w).Encode(&Response{
+			ItemReferenceID:      42,
+			VerificationResponse: verification,
+			AccountResponseCode:  "_1111",
+			BankName:             "FIRST BANK",
+			ErrorMessage:         "bad credentials",
+		})
+	}))
+}
+
+func TestVerify(t *testing.T) {
+	Convey("Given a GIACT stand-in server", t, func() {
+		inquiry := &Inquiry{
+			UniqueID:       "req-1",
+			Check:          &Check{RoutingNumber: "122105278", AccountNumber: "0000000016", AccountType: Savings},
+			GVerifyEnabled: true,
+		}
+
+		Convey("The inquiry is posted with the client's credentials", func() {
+			var got Inquiry
+			var auth string
+			ts := standIn(Pass, &got, &auth)
+			defer ts.Close()
+
+			resp, err := New(ts.URL+"/", "Basic abc", 0).Verify(context.Background(), inquiry)
+			So(err, ShouldBeNil)
+			So(auth, ShouldEqual, "Basic abc")
+			So(got.Check.AccountNumber, ShouldEqual, "0000000016")
+			So(got.Check.AccountType, ShouldEqual, Savings)
+			So(resp.ItemReferenceID, ShouldEqual, 42)
+			So(resp.Outcome(), ShouldEqual, OutcomePass)
+		})
+
+		Convey("GIACT errors are returned as errors", func() {
+			var got Inquiry
+			var auth string
+			ts := standIn(Error, &got, &auth)
+			defer ts.Close()
+
+			_, err := New(ts.URL, "Basic abc", 0).Verify(context.Background(), inquiry)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "giact: bad credentials")
+		})
+
+		Convey("Unexpected HTTP statuses are returned as errors", func() {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			}))
+			defer ts.Close()
+
+			_, err := New(ts.URL, "Basic abc", 0).Verify(context.Background(), inquiry)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestOutcome(t *testing.T) {
+	Convey("GIACT verification responses map to our outcomes", t, func() {
+		tests := []struct {
+			verification VerificationResponse
+			outcome      Outcome
+		}{
+			{Pass, OutcomePass},
+			{PrivateBadChecksList, OutcomeFail},
+			{Declined, OutcomeFail},
+			{RejectItem, OutcomeFail},
+			{NegativeData, OutcomeFail},
+			{AcceptWithRisk, OutcomeReview},
+			{RiskAlert, OutcomeReview},
+			{NoData, OutcomeReview},
+			{VerificationResponse(99), OutcomeReview},
+		}
+		for _, test := range tests {
+			resp := &Response{VerificationResponse: test.verification}
+			So(resp.Outcome(), ShouldEqual, test.outcome)
+		}
+	})
+
+	Convey("GIACT account response codes can only make the outcome worse", t, func() {
+		tests := []struct {
+			verification VerificationResponse
+			code         AccountResponseCode
+			outcome      Outcome
+		}{
+			{Pass, CheckingVerified, OutcomePass},
+			{Pass, SavingsVerified, OutcomePass},
+			{Pass, AmexVerified, OutcomePass},
+			{Pass, NonParticipant, OutcomePass},
+			{Pass, InvalidRoutingNumber, OutcomeFail},
+			{Pass, InvalidAccountNumber, OutcomeFail},
+			{Pass, PrivateBadChecks, OutcomeFail},
+			{Pass, AccountDeclined, OutcomeFail},
+			{Pass, AccountRejected, OutcomeFail},
+			{Pass, NonDemandDeposit, OutcomeFail},
+			{Pass, CurrentNegativeData, OutcomeReview},
+			{Pass, RecentNegativeData, OutcomeReview},
+			{Pass, NoAccountData, OutcomeReview},
+			{Pass, GovernmentRouting, OutcomeReview},
+			{Pass, AccountResponseCode("ZZ99"), OutcomeReview},
+			{NoData, CheckingVerified, OutcomeReview},
+			{AcceptWithRisk, InvalidAccountNumber, OutcomeFail},
+			{Declined, CheckingVerified, OutcomeFail},
+		}
+		for _, test := range tests {
+			resp := &Response{VerificationResponse: test.verification, AccountResponseCode: test.code}
+			So(resp.Outcome(), ShouldEqual, test.outcome)
+		}
+	})
+}
+
+func TestPing(t *testing.T) {
+	Convey("Any HTTP answer means GIACT is reachable", t, func() {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		client := New(ts.URL, "Basic abc", time.Second)
+		So(client.Ping(context.Background()), ShouldBeNil)
+
+		ts.Close()
+		So(client.Ping(context.Background()), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/problem"
+)
+
+// entityTag returns a strong entity tag for a representation.
+func entityTag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// encodeJSON encodes v the way render.JSON does.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(true)
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+// renderConditional renders v as JSON with an ETag of the body, and a
+// Last-Modified when modified is set. A GET or HEAD whose If-None-Match,
+// or failing that If-Modified-Since, shows the client already has it
+// gets a 304 without a body.
+func renderConditional(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) {
+	body, err := encodeJSON(v)
+	if err != nil {
+		problem.Render(w, r, http.StatusInternalServerError, "unable to encode response")
+		return
+	}
+
+	tag := entityTag(body)
+	w.Header().Set("ETag", tag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if notModified(r, tag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(body)
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchTag(inm, tag, false)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// checkPreconditions evaluates If-Match and If-Unmodified-Since against
+// the current state of a resource before it is changed. It renders a
+// 412 and returns false when they fail, so a client can't overwrite
+// changes it hasn't seen.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) bool {
+	ok := true
+	if im := r.Header.Get("If-Match"); im != "" {
+		body, err := encodeJSON(v)
+		ok = err == nil && matchTag(im, entityTag(body), true)
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ius)
+		ok = err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	if !ok {
+		problem.Render(w, r, http.StatusPreconditionFailed, "the resource has changed since it was last fetched")
+	}
+	return ok
+}
+
+// matchTag reports whether a list of entity tags in a header matches
+// tag. "*" matches any tag. The strong comparison used by If-Match
+// never matches weak tags; the weak one used by If-None-Match ignores
+// the W/ prefix.
+func matchTag(header, tag string, strong bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if strings.HasPrefix(t, "W/") {
+			if strong {
+				continue
+			}
+			t = t[2:]
+		}
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstroot/chi_api/models"
+	"github.com/dstroot/chi_api/patch"
+	"github.com/pressly/chi"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	Convey("Given the article routes", t, func() {
+		Articles = models.NewMemoryArticleStore()
+		r := chi.NewRouter()
+		r.Route("/articles/:articleID", func(r chi.Router) {
+			r.Use(ArticleCtx)
+			r.Get("/", GetArticle)
+			r.Head("/", GetArticle)
+			r.Put("/", UpdateArticle)
+			r.Delete("/", DeleteArticle)
+		})
+
+		do := func(method, body string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/articles/1", strings.NewReader(body))
+			for i := 0; i+1 < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		first := do("GET", "")
+		tag := first.Header().Get("ETag")
+		So(tag, ShouldStartWith, `"`)
+		So(first.Header().Get("Last-Modified"), ShouldNotBeEmpty)
+
+		Convey("A GET with a matching If-None-Match is not modified", func() {
+			w := do("GET", "", "If-None-Match", `"other", W/`+tag)
+			So(w.Code, ShouldEqual, http.StatusNotModified)
+			So(w.Body.Len(), ShouldEqual, 0)
+			So(w.Header().Get("ETag"), ShouldEqual, tag)
+		})
+
+		Convey("A HEAD with a matching If-None-Match is not modified", func() {
+			w := do("HEAD", "", "If-None-Match", tag)
+			So(w.Code, ShouldEqual, http.StatusNotModified)
+			So(w.Header().Get("ETag"), ShouldEqual, tag)
+		})
+
+		Convey("A HEAD without validators is answered like a GET", func() {
+			w := do("HEAD", "")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("ETag"), ShouldEqual, tag)
+		})
+
+		Convey("A GET with If-Modified-Since now is not modified", func() {
+			w := do("GET", "", "If-Modified-Since", time.Now().Add(time.Second).UTC().Format(http.TimeFormat))
+			So(w.Code, ShouldEqual, http.StatusNotModified)
+		})
+
+		Convey("A PUT with a stale If-Match fails", func() {
+			w := do("PUT", `{"title":"changed"}`, "If-Match", `"stale"`)
+			So(w.Code, ShouldEqual, http.StatusPreconditionFailed)
+		})
+
+		Convey("A PUT with the current If-Match succeeds with a new ETag", func() {
+			w := do("PUT", `{"title":"changed"}`, "If-Match", tag)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("ETag"), ShouldNotEqual, tag)
+
+			Convey("and the old ETag no longer deletes it", func() {
+				So(do("DELETE", "", "If-Match", tag).Code, ShouldEqual, http.StatusPreconditionFailed)
+			})
+		})
+
+		Convey("A weak If-Match never matches", func() {
+			So(do("DELETE", "", "If-Match", "W/"+tag).Code, ShouldEqual, http.StatusPreconditionFailed)
+		})
+	})
+}
+
+func TestPatchArticle(t *testing.T) {
+	Convey("Given the article routes", t, func() {
+		Articles = models.NewMemoryArticleStore()
+		r := chi.NewRouter()
+		r.Route("/articles/:articleID", func(r chi.Router) {
+			r.Use(ArticleCtx)
+			r.Put("/", UpdateArticle)
+			r.Patch("/", PatchArticle)
+		})
+
+		do := func(method, contentType, body string) (*httptest.ResponseRecorder, *models.Article) {
+			req := httptest.NewRequest(method, "/articles/1", strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			var article models.Article
+			json.Unmarshal(w.Body.Bytes(), &article)
+			return w, &article
+		}
+
+		tests := []struct {
+			name        string
+			method      string
+			contentType string
+			body        string
+			status      int
+			title       string
+		}{
+			{"a merge patch", "PATCH", patch.MergePatchType, `{"title":"merged"}`, http.StatusOK, "merged"},
+			{"a JSON patch", "PATCH", patch.JSONPatchType, `[{"op":"test","path":"/version","value":1},{"op":"replace","path":"/title","value":"patched"}]`, http.StatusOK, "patched"},
+			{"a JSON patch with a failed test", "PATCH", patch.JSONPatchType, `[{"op":"test","path":"/version","value":7}]`, http.StatusConflict, ""},
+			{"a malformed patch", "PATCH", patch.JSONPatchType, `{"op":"remove"}`, http.StatusBadRequest, ""},
+			{"a patch of a missing path", "PATCH", patch.JSONPatchType, `[{"op":"remove","path":"/nope"}]`, http.StatusUnprocessableEntity, ""},
+			{"a patch changing the id", "PATCH", patch.MergePatchType, `{"id":"9"}`, http.StatusUnprocessableEntity, ""},
+			{"a patch of a stale version", "PATCH", patch.MergePatchType, `{"version":0,"title":"late"}`, http.StatusConflict, ""},
+			{"a plain JSON patch", "PATCH", "application/json", `{"title":"x"}`, http.StatusUnsupportedMediaType, ""},
+			{"a put of the current version", "PUT", "application/json", `{"title":"put","version":1}`, http.StatusOK, "put"},
+			{"a put of a stale version", "PUT", "application/json", `{"title":"put","version":2}`, http.StatusConflict, ""},
+			{"a put without a version or If-Match", "PUT", "application/json", `{"title":"put"}`, http.StatusPreconditionRequired, ""},
+		}
+		for _, test := range tests {
+			test := test
+			Convey("When the request is "+test.name, func() {
+				w, article := do(test.method, test.contentType, test.body)
+				So(w.Code, ShouldEqual, test.status)
+				if test.status == http.StatusOK {
+					So(article.Title, ShouldEqual, test.title)
+					So(article.Version, ShouldEqual, 2)
+				}
+			})
+		}
+	})
+}
+
+// racingStore updates an article just before deleting it, like a
+// concurrent request landing between the precondition check and the
+// delete.
+type racingStore struct {
+	models.ArticleStore
+}
+
+func (s racingStore) DeleteArticle(ctx context.Context, id string, version int64) (*models.Article, error) {
+	article, _ := s.GetArticle(ctx, id)
+	s.UpdateArticle(ctx, article)
+	return s.ArticleStore.DeleteArticle(ctx, id, version)
+}
+
+func TestDeleteArticleRace(t *testing.T) {
+	Convey("A delete racing an update is a conflict", t, func() {
+		Articles = racingStore{models.NewMemoryArticleStore()}
+		r := chi.NewRouter()
+		r.Route("/articles/:articleID", func(r chi.Router) {
+			r.Use(ArticleCtx)
+			r.Delete("/", DeleteArticle)
+		})
+
+		req := httptest.NewRequest("DELETE", "/articles/1", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+
+		_, err := Articles.GetArticle(context.Background(), "1")
+		So(err, ShouldBeNil)
+	})
+}
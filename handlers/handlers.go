@@ -2,25 +2,53 @@ package handler
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"math/rand"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/logging"
 	"github.com/dstroot/chi_api/models"
+	"github.com/dstroot/chi_api/patch"
+	"github.com/dstroot/chi_api/problem"
+	"github.com/dstroot/chi_api/validation"
+	"github.com/pkg/errors"
 	"github.com/pressly/chi"
+	"github.com/pressly/chi/middleware"
 	"github.com/pressly/chi/render"
 )
 
-// Article struct
-type Article struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
-}
-
-var articles = []*Article{
-	{ID: "1", Title: "Hi"},
-	{ID: "2", Title: "sup"},
+// Articles is the store the article handlers read from and write to.
+// It must be set before the routes are served.
+var Articles models.ArticleStore
+
+// queryFailed answers a request whose query failed. A query that ran
+// out of time is a 504 and one the client gave up on a 499, each with
+// its own code, so neither is mistaken for a fault of ours; anything
+// else is logged as msg with kv and answered with a 500 and detail.
+func queryFailed(w http.ResponseWriter, r *http.Request, err error, detail, msg string, kv ...interface{}) {
+	log := logging.FromContext(r.Context())
+	kv = append(kv, "error", err)
+	switch err {
+	case models.ErrQueryTimeout:
+		log.Warn(msg, kv...)
+		p := problem.New(http.StatusGatewayTimeout, "the query took too long")
+		p.Code = problem.CodeQueryTimeout
+		problem.Write(w, r, p)
+	case models.ErrQueryCanceled:
+		log.Info(msg, kv...)
+		p := problem.New(middleware.StatusClientClosedRequest, "the request was canceled")
+		p.Title = "Client Closed Request"
+		p.Code = problem.CodeQueryCanceled
+		problem.Write(w, r, p)
+	default:
+		log.Error(msg, kv...)
+		problem.Render(w, r, http.StatusInternalServerError, detail)
+	}
 }
 
 // https://github.com/golang/lint/pull/245
@@ -40,7 +68,7 @@ type Key struct {
 	article string
 }
 
-var key Key
+var key = Key{article: "article"}
 
 // ArticleCtx middleware is used to load an Article object from
 // the URL parameters passed through as the request. In case
@@ -48,49 +76,107 @@ var key Key
 func ArticleCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		articleID := chi.URLParam(r, "articleID")
-		article, err := dbGetArticle(articleID)
+		article, err := Articles.GetArticle(r.Context(), articleID)
+		if err == models.ErrArticleNotFound {
+			problem.Render(w, r, http.StatusNotFound, "no article with id "+articleID)
+			return
+		}
 		if err != nil {
-			render.Status(r, http.StatusNotFound)
-			render.JSON(w, r, http.StatusText(http.StatusNotFound))
+			queryFailed(w, r, err, "unable to load article", "load article", "article_id", articleID)
 			return
 		}
 
-		// set context key
-		key.article = "article"
 		ctx := context.WithValue(r.Context(), key, article)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// SearchArticles searches the Articles data for a matching article.
-// It's just a stub, but you get the idea.
+// SearchArticles searches article titles for the words in the q param,
+// best matches first. Results can be filtered by field, e.g. title=Hi,
+// and ordered with sort, e.g. sort=-score,title.
 func SearchArticles(w http.ResponseWriter, r *http.Request) {
-	// Filter by query param, and search...
-	render.JSON(w, r, articles)
+	query := r.URL.Query()
+	search := models.SearchQuery{
+		Text:    query.Get("q"),
+		Filters: make(map[string]string),
+		Limit:   DefaultPageLimit,
+	}
+
+	var errs validation.Errors
+	for _, field := range models.ArticleSearchFields {
+		if value := query.Get(field); value != "" {
+			search.Filters[field] = value
+		}
+	}
+	if strings.TrimSpace(search.Text) == "" && len(search.Filters) == 0 {
+		errs.Add("q", "is required without a field filter")
+	}
+	if s := query.Get("sort"); s != "" {
+		sort, err := models.ParseSort(s)
+		if err != nil {
+			errs.Add("sort", "must be a list of score, %s", strings.Join(models.ArticleSearchFields, ", "))
+		}
+		search.Sort = sort
+	}
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxPageLimit {
+			errs.Add("limit", "must be between 1 and %d", MaxPageLimit)
+		}
+		search.Limit = n
+	}
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+
+	results, err := Articles.SearchArticles(r.Context(), search)
+	if err != nil {
+		queryFailed(w, r, err, "unable to search articles", "search articles")
+		return
+	}
+	render.JSON(w, r, &Page{Data: results})
 }
 
-// ListArticles returns an array of Articles.
+// ListArticles returns a page of Articles.
 func ListArticles(w http.ResponseWriter, r *http.Request) {
-	render.JSON(w, r, articles)
+	page := PageFromContext(r.Context())
+
+	articles, err := Articles.ListArticles(r.Context(), page.Query())
+	if err != nil {
+		queryFailed(w, r, err, "unable to list articles", "list articles")
+		return
+	}
+	renderPage(w, r, page, articles, func(i int) string { return articles[i].ID })
 }
 
 // CreateArticle persists the posted Article and returns it
 // back to the client as an acknowledgement.
 func CreateArticle(w http.ResponseWriter, r *http.Request) {
 	var data struct {
-		*Article
+		*models.Article
 		OmitID interface{} `json:"id,omitempty"` // prevents 'id' from being set
 	}
 	// ^ the above is a nifty trick for how to omit fields during json unmarshalling
 	// through struct composition
 
 	if err := render.Bind(r.Body, &data); err != nil {
-		render.JSON(w, r, err.Error())
+		problem.Render(w, r, http.StatusBadRequest, "malformed article: "+err.Error())
+		return
+	}
+	if data.Article == nil {
+		data.Article = &models.Article{}
+	}
+	if errs := data.Article.Validate(); len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusUnprocessableEntity, errs)
 		return
 	}
 
 	article := data.Article
-	dbNewArticle(article)
+	if err := Articles.CreateArticle(r.Context(), article); err != nil {
+		queryFailed(w, r, err, "unable to create article", "create article")
+		return
+	}
 
 	render.JSON(w, r, article)
 }
@@ -103,29 +189,134 @@ func GetArticle(w http.ResponseWriter, r *http.Request) {
 	// Assume if we've reach this far, we can access the article
 	// context because this handler is a child of the ArticleCtx
 	// middleware. The worst case, the recoverer middleware will save us.
-	article := r.Context().Value(key).(*Article)
+	article := r.Context().Value(key).(*models.Article)
 
 	// chi provides a basic companion subpackage "github.com/pressly/chi/render", however
-	// you can use any responder compatible with net/http.
-	render.JSON(w, r, article)
+	// you can use any responder compatible with net/http. Here the ETag
+	// and Last-Modified let polling clients get a 304 instead.
+	renderConditional(w, r, article, article.UpdatedAt)
 }
 
 // UpdateArticle updates an existing Article in our persistent store.
+// The body must carry the article's current version, or the request an
+// If-Match header, so a stale write can't overwrite newer changes.
 func UpdateArticle(w http.ResponseWriter, r *http.Request) {
-	article := r.Context().Value(key).(*Article)
+	article := r.Context().Value(key).(*models.Article)
+	if !checkPreconditions(w, r, article, article.UpdatedAt) {
+		return
+	}
 
+	// bind onto a copy so an invalid payload leaves the article untouched
+	update := *article
 	data := struct {
-		*Article
-		OmitID interface{} `json:"id,omitempty"` // prevents 'id' from being overridden
-	}{Article: article}
+		*models.Article
+		OmitID  interface{} `json:"id,omitempty"` // prevents 'id' from being overridden
+		Version *int64      `json:"version"`      // tells a missing version from 0
+	}{Article: &update}
 
 	if err := render.Bind(r.Body, &data); err != nil {
-		render.JSON(w, r, err)
+		problem.Render(w, r, http.StatusBadRequest, "malformed article: "+err.Error())
 		return
 	}
-	article = data.Article
+	// a write that doesn't say which version it changes could silently
+	// overwrite changes its client hasn't seen
+	if data.Version == nil && r.Header.Get("If-Match") == "" {
+		problem.Render(w, r, http.StatusPreconditionRequired, "the article's version or an If-Match header is required")
+		return
+	}
+	if data.Version != nil {
+		update.Version = *data.Version
+	}
+	saveArticle(w, r, article, &update)
+}
 
-	render.JSON(w, r, article)
+// PatchArticle changes an existing Article with a JSON Merge Patch or
+// a JSON Patch, told apart by the Content-Type. The patch applies to
+// the article as it was loaded, and the result is only saved if no one
+// else saved it in between.
+func PatchArticle(w http.ResponseWriter, r *http.Request) {
+	article := r.Context().Value(key).(*models.Article)
+	if !checkPreconditions(w, r, article, article.UpdatedAt) {
+		return
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case patch.MergePatchType:
+		apply = patch.Merge
+	case patch.JSONPatchType:
+		apply = patch.Apply
+	default:
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		problem.Render(w, r, http.StatusUnsupportedMediaType, "patches must be "+patch.MergePatchType+" or "+patch.JSONPatchType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		problem.Render(w, r, http.StatusBadRequest, "unable to read patch: "+err.Error())
+		return
+	}
+	doc, err := encodeJSON(article)
+	if err != nil {
+		problem.Render(w, r, http.StatusInternalServerError, "unable to encode article")
+		return
+	}
+	patched, err := apply(doc, body)
+	switch {
+	case err == patch.ErrTestFailed:
+		problem.Render(w, r, http.StatusConflict, "a test operation of the patch failed")
+		return
+	case errors.Cause(err) == patch.ErrMalformed:
+		problem.Render(w, r, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		problem.Render(w, r, http.StatusUnprocessableEntity, "unable to apply patch: "+err.Error())
+		return
+	}
+
+	var update models.Article
+	if err = json.Unmarshal(patched, &update); err != nil {
+		problem.Render(w, r, http.StatusUnprocessableEntity, "patched article is malformed: "+err.Error())
+		return
+	}
+	if update.ID != article.ID {
+		var errs validation.Errors
+		errs.Add("id", "can't be changed")
+		problem.Invalid(w, r, http.StatusUnprocessableEntity, errs)
+		return
+	}
+	saveArticle(w, r, article, &update)
+}
+
+// saveArticle validates and saves the update of an article, which must
+// be at the version of the article as loaded, and renders it.
+func saveArticle(w http.ResponseWriter, r *http.Request, article, update *models.Article) {
+	if errs := update.Validate(); len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusUnprocessableEntity, errs)
+		return
+	}
+	if update.Version != article.Version {
+		problem.Render(w, r, http.StatusConflict, fmt.Sprintf("article is at version %d, not %d", article.Version, update.Version))
+		return
+	}
+
+	err := Articles.UpdateArticle(r.Context(), update)
+	switch err {
+	case nil:
+	case models.ErrArticleNotFound:
+		problem.Render(w, r, http.StatusNotFound, "article was deleted")
+		return
+	case models.ErrVersionConflict:
+		problem.Render(w, r, http.StatusConflict, "article was changed by another request")
+		return
+	default:
+		queryFailed(w, r, err, "unable to update article", "update article", "article_id", update.ID)
+		return
+	}
+
+	renderConditional(w, r, update, update.UpdatedAt)
 }
 
 // DeleteArticle removes an existing Article from our persistent store.
@@ -135,11 +326,23 @@ func DeleteArticle(w http.ResponseWriter, r *http.Request) {
 	// Assume if we've reach this far, we can access the article
 	// context because this handler is a child of the ArticleCtx
 	// middleware. The worst case, the recoverer middleware will save us.
-	article := r.Context().Value(key).(*Article)
+	article := r.Context().Value(key).(*models.Article)
+	if !checkPreconditions(w, r, article, article.UpdatedAt) {
+		return
+	}
 
-	article, err = dbRemoveArticle(article.ID)
+	// delete the version the preconditions were checked against
+	article, err = Articles.DeleteArticle(r.Context(), article.ID, article.Version)
+	if err == models.ErrArticleNotFound {
+		problem.Render(w, r, http.StatusNotFound, "article was already deleted")
+		return
+	}
+	if err == models.ErrVersionConflict {
+		problem.Render(w, r, http.StatusConflict, "article was changed by another request")
+		return
+	}
 	if err != nil {
-		render.JSON(w, r, err)
+		queryFailed(w, r, err, "unable to delete article", "delete article", "article_id", chi.URLParam(r, "articleID"))
 		return
 	}
 
@@ -151,6 +354,8 @@ func DeleteArticle(w http.ResponseWriter, r *http.Request) {
 func AdminRouter() chi.Router {
 	r := chi.NewRouter()
 	r.Use(AdminOnly)
+	r.NotFound(problem.NotFound)
+	r.MethodNotAllowed(problem.MethodNotAllowed)
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("admin: index"))
 	})
@@ -160,76 +365,25 @@ func AdminRouter() chi.Router {
 	r.Get("/users/:userId", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(fmt.Sprintf("admin: view user id %v", chi.URLParam(r, "userId"))))
 	})
+	r.Delete("/cache/taxpro", PurgeTaxProCache)
 	return r
 }
 
 // AdminOnly middleware restricts access to just administrators.
+// Anonymous requests get a 401, authenticated ones without the
+// admin role a 403.
 func AdminOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		isAdmin, ok := r.Context().Value("acl.admin").(bool)
-		if !ok || !isAdmin {
-			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			problem.Render(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !principal.HasRole(auth.RoleAdmin) {
+			problem.Render(w, r, http.StatusForbidden, "admin role required")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
-
-// Paginate is a stub, but very possible to implement middleware logic
-// to handle the request params for handling a paginated request.
-func Paginate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// just a stub.. some ideas are to look at URL query params for something like
-		// the page number, or the limit, and send a query cursor down the chain
-		next.ServeHTTP(w, r)
-	})
-}
-
-//--
-
-// Below are a bunch of helper functions that mock some kind of storage
-
-func dbNewArticle(article *Article) (string, error) {
-	article.ID = fmt.Sprintf("%d", rand.Intn(100)+10)
-	articles = append(articles, article)
-	return article.ID, nil
-}
-
-func dbGetArticle(id string) (*Article, error) {
-	for _, a := range articles {
-		if a.ID == id {
-			return a, nil
-		}
-	}
-	return nil, errors.New("article not found")
-}
-
-func dbRemoveArticle(id string) (*Article, error) {
-	for i, a := range articles {
-		if a.ID == id {
-			articles = append((articles)[:i], (articles)[i+1:]...)
-			return a, nil
-		}
-	}
-	return nil, errors.New("article not found")
-}
-
-// TaxPro Route
-func TaxPro(w http.ResponseWriter, r *http.Request) {
-
-	// Get params
-	efin := chi.URLParam(r, "efin") // c.Param("efin")
-	year := chi.URLParam(r, "year") // c.Param("year")
-
-	// Get tax professionals
-	results, err := models.GetTaxpro(year, efin)
-	if err != nil {
-		render.Status(r, http.StatusNotFound)
-		render.JSON(w, r, http.StatusText(http.StatusNotFound))
-		render.JSON(w, r, err.Error())
-		return
-	}
-
-	// Render results
-	render.JSON(w, r, results)
-}
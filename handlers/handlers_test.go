@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dstroot/chi_api/auth"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var admin = &auth.Principal{Subject: "ops", Roles: []string{auth.RoleAdmin}, Method: "api_key"}
+
+func TestAdminRouter(t *testing.T) {
+	Convey("Given the admin router", t, func() {
+		get := func(principal *auth.Principal) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", "/accounts", nil)
+			if principal != nil {
+				r = r.WithContext(auth.NewContext(r.Context(), principal))
+			}
+			w := httptest.NewRecorder()
+			AdminRouter().ServeHTTP(w, r)
+			return w
+		}
+
+		Convey("Anonymous requests must authenticate", func() {
+			w := get(nil)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(w.Header().Get("WWW-Authenticate"), ShouldEqual, "Bearer")
+		})
+
+		Convey("Callers without the admin role are forbidden", func() {
+			So(get(&auth.Principal{Subject: "intuit", Roles: []string{auth.RolePartner}}).Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("Admins get the plain text answer", func() {
+			w := get(admin)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldEqual, "admin: list accounts..")
+		})
+	})
+}
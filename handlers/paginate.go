@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/models"
+	"github.com/dstroot/chi_api/problem"
+	"github.com/dstroot/chi_api/validation"
+)
+
+// Page limits, set from our configuration at startup.
+var (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+	MaxPageOffset    = 10000
+)
+
+// PageRequest is the page of a listing requested by the client. A
+// request either uses an offset, or an opaque cursor handed out in the
+// next/prev links of a previous page.
+type PageRequest struct {
+	Limit  int
+	Offset int
+	Cursor bool   // true when paging by cursor
+	After  string // key of the last item of the previous page
+	Before string // key of the first item of the next page
+}
+
+// Query returns the store query for the page. It asks for one extra
+// item so we can tell whether there is another page.
+func (p *PageRequest) Query() models.PageQuery {
+	return models.PageQuery{Limit: p.Limit + 1, Offset: p.Offset, After: p.After, Before: p.Before}
+}
+
+// pageKey is the context key for the page request.
+type pageKey struct{}
+
+// PageFromContext returns the page request of a paginated route.
+func PageFromContext(ctx context.Context) *PageRequest {
+	if p, ok := ctx.Value(pageKey{}).(*PageRequest); ok {
+		return p
+	}
+	return &PageRequest{Limit: DefaultPageLimit, Cursor: true}
+}
+
+// Paginate parses the limit, offset and cursor query params of a list
+// request and puts the page request on the context. Requests with an
+// offset page by offset, all others page by cursor.
+func Paginate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		page := &PageRequest{Limit: DefaultPageLimit, Cursor: true}
+
+		var errs validation.Errors
+		if s := query.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > MaxPageLimit {
+				errs.Add("limit", "must be between 1 and %d", MaxPageLimit)
+			}
+			page.Limit = n
+		}
+		if s := query.Get("offset"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || n > MaxPageOffset {
+				errs.Add("offset", "must be between 0 and %d", MaxPageOffset)
+			}
+			page.Offset, page.Cursor = n, false
+		}
+		if s := query.Get("cursor"); s != "" {
+			if !page.Cursor {
+				errs.Add("cursor", "can't be combined with offset")
+			} else if !page.decodeCursor(s) {
+				errs.Add("cursor", "is invalid")
+			}
+		}
+		if len(errs) > 0 {
+			problem.Invalid(w, r, http.StatusBadRequest, errs)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), pageKey{}, page)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// encodeCursor returns an opaque cursor for the items after or before a key.
+func encodeCursor(direction string, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + ":" + key))
+}
+
+// decodeCursor sets the After or Before key from a cursor.
+func (p *PageRequest) decodeCursor(cursor string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return false
+	}
+	switch parts[0] {
+	case "a":
+		p.After = parts[1]
+	case "b":
+		p.Before = parts[1]
+	default:
+		return false
+	}
+	return true
+}
+
+// Page is the envelope of a page of a listing.
+type Page struct {
+	Data interface{} `json:"data"`
+	Next string      `json:"next,omitempty"`
+	Prev string      `json:"prev,omitempty"`
+}
+
+// renderPage renders a page of items fetched with page.Query(), i.e.
+// with one item of look-ahead, along with next/prev links both in the
+// envelope and in an RFC 5988 Link header. key returns the cursor key
+// of the i-th item.
+func renderPage(w http.ResponseWriter, r *http.Request, page *PageRequest, items interface{}, key func(i int) string) {
+	v := reflect.ValueOf(items)
+	from, to := 0, v.Len()
+
+	// drop the look-ahead item; paging backwards it is the first one
+	more := to > page.Limit
+	if more && page.Before != "" {
+		from++
+	} else if more {
+		to--
+	}
+
+	var next, prev string
+	if page.Cursor {
+		hasNext := more || page.Before != ""
+		hasPrev := (more && page.Before != "") || page.After != ""
+		if hasNext && to > from {
+			next = pageURL(r, "cursor", encodeCursor("a", key(to-1)))
+		}
+		if hasPrev && to > from {
+			prev = pageURL(r, "cursor", encodeCursor("b", key(from)))
+		}
+	} else {
+		if more {
+			next = pageURL(r, "offset", strconv.Itoa(page.Offset+page.Limit))
+		}
+		if page.Offset > 0 {
+			offset := page.Offset - page.Limit
+			if offset < 0 {
+				offset = 0
+			}
+			prev = pageURL(r, "offset", strconv.Itoa(offset))
+		}
+	}
+
+	var links []string
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, prev))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	renderConditional(w, r, &Page{Data: v.Slice(from, to).Interface(), Next: next, Prev: prev}, time.Time{})
+}
+
+// pageURL returns the request URL with a page param replaced.
+func pageURL(r *http.Request, param string, value string) string {
+	query := r.URL.Query()
+	query.Del("cursor")
+	query.Del("offset")
+	query.Set(param, value)
+	return r.URL.Path + "?" + query.Encode()
+}
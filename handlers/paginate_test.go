@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dstroot/chi_api/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPaginate(t *testing.T) {
+	Convey("Given seven articles", t, func() {
+		store := models.NewMemoryArticleStore()
+		for i := 0; i < 5; i++ {
+			store.CreateArticle(context.Background(), &models.Article{Title: "more"})
+		}
+		Articles = store
+
+		list := func(url string) (*httptest.ResponseRecorder, []string, *Page) {
+			w := httptest.NewRecorder()
+			Paginate(http.HandlerFunc(ListArticles)).ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+			var page struct {
+				Page
+				Data []*models.Article `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &page)
+			ids := make([]string, 0)
+			for _, a := range page.Data {
+				ids = append(ids, a.ID)
+			}
+			return w, ids, &page.Page
+		}
+
+		Convey("Cursors walk forwards and backwards", func() {
+			w, ids, page := list("/articles?limit=3")
+			So(ids, ShouldResemble, []string{"1", "2", "3"})
+			So(page.Prev, ShouldEqual, "")
+			So(w.Header().Get("Link"), ShouldEqual, `<`+page.Next+`>; rel="next"`)
+
+			_, ids, page = list(page.Next)
+			So(ids, ShouldResemble, []string{"4", "5", "6"})
+
+			_, ids, last := list(page.Next)
+			So(ids, ShouldResemble, []string{"7"})
+			So(last.Next, ShouldEqual, "")
+
+			_, ids, _ = list(page.Prev)
+			So(ids, ShouldResemble, []string{"1", "2", "3"})
+		})
+
+		Convey("Offsets page with next and prev links", func() {
+			w, ids, page := list("/articles?limit=3&offset=3")
+			So(ids, ShouldResemble, []string{"4", "5", "6"})
+			So(page.Next, ShouldEqual, "/articles?limit=3&offset=6")
+			So(page.Prev, ShouldEqual, "/articles?limit=3&offset=0")
+			So(w.Header().Get("Link"), ShouldEqual,
+				`</articles?limit=3&offset=6>; rel="next", </articles?limit=3&offset=0>; rel="prev"`)
+		})
+
+		Convey("Out of range params are rejected", func() {
+			for _, url := range []string{"/articles?limit=0", "/articles?limit=1000", "/articles?offset=-1", "/articles?cursor=bogus"} {
+				w, _, _ := list(url)
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+			}
+		})
+	})
+}
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dstroot/chi_api/partner"
+	"github.com/pressly/chi/render"
+)
+
+// Partners is the registry of configured partners.
+var Partners = partner.NewRegistry()
+
+// ListPartners returns the configured partners.
+func ListPartners(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, Partners.List())
+}
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/dstroot/chi_api/logging"
+	"github.com/dstroot/chi_api/models"
+	"github.com/dstroot/chi_api/partner"
+	"github.com/dstroot/chi_api/problem"
+	"github.com/dstroot/chi_api/validation"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// TaxPros is the repository the tax professional handlers read from.
+// It must be set before the routes are served.
+var TaxPros models.TaxProRepository
+
+// TaxProCache caches TaxPros lookups. It's nil when caching is off.
+var TaxProCache *models.CachedTaxProRepository
+
+// canSee reports whether a system year is within the data scope of
+// the partner verified by its API key. Other callers have the default
+// scope of every year, whatever partner they claim.
+func canSee(r *http.Request, year string) bool {
+	p, ok := partner.FromContext(r.Context())
+	return !ok || p.CanSee(year)
+}
+
+// inScope checks that a system year is within the data scope of the
+// requesting partner, and renders a 403 if it isn't.
+func inScope(w http.ResponseWriter, r *http.Request, year string) bool {
+	if !canSee(r, year) {
+		p, _ := partner.FromContext(r.Context())
+		problem.Render(w, r, http.StatusForbidden, fmt.Sprintf("system year %s is not available to %s", year, p.Name))
+		return false
+	}
+	return true
+}
+
+// TaxPro returns a single tax professional for a system year.
+func TaxPro(w http.ResponseWriter, r *http.Request) {
+
+	// Get params
+	efin := chi.URLParam(r, "efin")
+	year := chi.URLParam(r, "year")
+
+	var errs validation.Errors
+	validation.Year(&errs, "year", year)
+	validation.EFIN(&errs, "efin", efin)
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+	if !inScope(w, r, year) {
+		return
+	}
+
+	// Get tax professional
+	pro, err := TaxPros.GetTaxpro(r.Context(), year, efin)
+	if err == models.ErrNotFound {
+		problem.Render(w, r, http.StatusNotFound, fmt.Sprintf("no tax professional with efin %s in %s", efin, year))
+		return
+	}
+	if err != nil {
+		queryFailed(w, r, err, "unable to look up tax professional", "get taxpro", "year", year, "efin", efin)
+		return
+	}
+
+	// Render result
+	renderConditional(w, r, pro, time.Time{})
+}
+
+// ListTaxPros returns every tax professional for a system year.
+func ListTaxPros(w http.ResponseWriter, r *http.Request) {
+	year := chi.URLParam(r, "year")
+
+	var errs validation.Errors
+	validation.Year(&errs, "year", year)
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+	if !inScope(w, r, year) {
+		return
+	}
+
+	results, err := TaxPros.ListTaxpros(r.Context(), year)
+	if err != nil {
+		queryFailed(w, r, err, "unable to list tax professionals", "list taxpros", "year", year)
+		return
+	}
+
+	page := PageFromContext(r.Context())
+	results = pageTaxPros(results, page)
+	renderPage(w, r, page, results, func(i int) string { return results[i].EFIN })
+}
+
+// SearchTaxPros returns the tax professionals for a system year whose
+// company name contains the "q" query param.
+func SearchTaxPros(w http.ResponseWriter, r *http.Request) {
+	year := chi.URLParam(r, "year")
+
+	var errs validation.Errors
+	validation.Year(&errs, "year", year)
+	validation.Required(&errs, "q", r.URL.Query().Get("q"))
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+	if !inScope(w, r, year) {
+		return
+	}
+
+	results, err := TaxPros.SearchTaxpros(r.Context(), year, r.URL.Query().Get("q"))
+	if err != nil {
+		queryFailed(w, r, err, "unable to search tax professionals", "search taxpros", "year", year)
+		return
+	}
+
+	page := PageFromContext(r.Context())
+	results = pageTaxPros(results, page)
+	renderPage(w, r, page, results, func(i int) string { return results[i].EFIN })
+}
+
+// pageTaxPros applies a page request, with one item of look-ahead, to
+// tax professionals ordered by EFIN.
+func pageTaxPros(pros []*models.TaxPro, page *PageRequest) []*models.TaxPro {
+	q := page.Query()
+	from, to := 0, len(pros)
+	switch {
+	case q.After != "":
+		from = sort.Search(len(pros), func(i int) bool { return pros[i].EFIN > q.After })
+	case q.Before != "":
+		to = sort.Search(len(pros), func(i int) bool { return pros[i].EFIN >= q.Before })
+		if to-q.Limit > from {
+			from = to - q.Limit
+		}
+	default:
+		from = q.Offset
+	}
+	if from > len(pros) {
+		from = len(pros)
+	}
+	if from+q.Limit < to {
+		to = from + q.Limit
+	}
+	return pros[from:to]
+}
+
+// MaxLookupBatch is the largest number of EFINs accepted by LookupTaxPros.
+var MaxLookupBatch = 500
+
+// TaxProLookup is the result of a bulk lookup for a single EFIN.
+type TaxProLookup struct {
+	EFIN   string         `json:"efin"`
+	Found  bool           `json:"found"`
+	TaxPro *models.TaxPro `json:"taxpro,omitempty"`
+}
+
+// LookupTaxPros looks up a JSON array of EFINs for a system year in a
+// single query, and returns one result per distinct EFIN in the order
+// they were posted, including explicit "not found" entries.
+func LookupTaxPros(w http.ResponseWriter, r *http.Request) {
+	year := chi.URLParam(r, "year")
+
+	var efins []string
+	if err := render.Bind(r.Body, &efins); err != nil {
+		problem.Render(w, r, http.StatusBadRequest, "expected a JSON array of efins: "+err.Error())
+		return
+	}
+	efins = distinct(efins)
+	if len(efins) == 0 {
+		problem.Render(w, r, http.StatusBadRequest, "at least one efin is required")
+		return
+	}
+	if len(efins) > MaxLookupBatch {
+		problem.Render(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d efins can be looked up at once", MaxLookupBatch))
+		return
+	}
+
+	var errs validation.Errors
+	validation.Year(&errs, "year", year)
+	for i, efin := range efins {
+		validation.EFIN(&errs, fmt.Sprintf("efins[%d]", i), efin)
+	}
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+	if !inScope(w, r, year) {
+		return
+	}
+
+	pros, err := TaxPros.LookupTaxpros(r.Context(), year, efins)
+	if err != nil {
+		queryFailed(w, r, err, "unable to look up tax professionals", "lookup taxpros", "year", year)
+		return
+	}
+
+	found := make(map[string]*models.TaxPro, len(pros))
+	for _, pro := range pros {
+		found[pro.EFIN] = pro
+	}
+
+	results := make([]*TaxProLookup, 0, len(efins))
+	for _, efin := range efins {
+		pro, ok := found[efin]
+		results = append(results, &TaxProLookup{EFIN: efin, Found: ok, TaxPro: pro})
+	}
+
+	render.JSON(w, r, results)
+}
+
+// distinct returns the strings without duplicates, keeping the first
+// of each.
+func distinct(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	unique := list[:0]
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// TaxProHistory returns the tax professional's record for every system
+// year it appears in, so growth and churn can be followed over time.
+func TaxProHistory(w http.ResponseWriter, r *http.Request) {
+	efin := chi.URLParam(r, "efin")
+
+	var errs validation.Errors
+	validation.EFIN(&errs, "efin", efin)
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+
+	results, err := TaxPros.TaxproHistory(r.Context(), efin)
+	if err != nil {
+		queryFailed(w, r, err, "unable to load tax professional history", "taxpro history", "efin", efin)
+		return
+	}
+
+	// only show the years within the partner's data scope
+	visible := results[:0]
+	for _, pro := range results {
+		if canSee(r, pro.Year) {
+			visible = append(visible, pro)
+		}
+	}
+	results = visible
+	if len(results) == 0 {
+		problem.Render(w, r, http.StatusNotFound, "no history for efin "+efin)
+		return
+	}
+
+	renderConditional(w, r, results, time.Time{})
+}
+
+// PurgeTaxProCache drops cached tax professionals, those of the efin
+// and/or year query params, or every one when neither is given.
+func PurgeTaxProCache(w http.ResponseWriter, r *http.Request) {
+	if TaxProCache == nil {
+		problem.Render(w, r, http.StatusNotFound, "the tax professional cache is disabled")
+		return
+	}
+
+	year := r.URL.Query().Get("year")
+	efin := r.URL.Query().Get("efin")
+
+	var errs validation.Errors
+	if year != "" {
+		validation.Year(&errs, "year", year)
+	}
+	if efin != "" {
+		validation.EFIN(&errs, "efin", efin)
+	}
+	if len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusBadRequest, errs)
+		return
+	}
+
+	n := TaxProCache.Purge(year, efin)
+	logging.FromContext(r.Context()).Info("purged taxpro cache", "year", year, "efin", efin, "purged", n)
+	render.JSON(w, r, map[string]int{"purged": n})
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/models"
+	"github.com/dstroot/chi_api/partner"
+	"github.com/dstroot/chi_api/problem"
+	"github.com/pressly/chi"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeTaxPros is a TaxProRepository that serves a fixed set of tax
+// professionals, or fails every call when err is set.
+type fakeTaxPros struct {
+	models.TaxProRepository
+	pros map[string]*models.TaxPro // year/efin -> pro
+	err  error
+}
+
+func (f *fakeTaxPros) GetTaxpro(ctx context.Context, year string, efin string) (*models.TaxPro, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	pro, ok := f.pros[year+"/"+efin]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return pro, nil
+}
+
+// as authenticates every request as the principal, from the partner
+// when one is given.
+func as(principal *auth.Principal, p *partner.Partner) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := auth.NewContext(r.Context(), principal)
+			if p != nil {
+				ctx = partner.NewContext(ctx, p)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func taxproRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/taxpro/:year/:efin", TaxPro)
+	return r
+}
+
+func TestTaxPro(t *testing.T) {
+	Convey("Given a tax professional repository", t, func() {
+		repo := &fakeTaxPros{pros: map[string]*models.TaxPro{
+			"2017/012345": {EFIN: "012345", CompanyName: "Acme Tax Service", ProductCount: 402},
+		}}
+		TaxPros = repo
+
+		tests := []struct {
+			name        string
+			path        string
+			err         error
+			status      int
+			contentType string
+		}{
+			{"found", "/taxpro/2017/012345", nil, http.StatusOK, "application/json; charset=utf-8"},
+			{"not found", "/taxpro/2017/999999", nil, http.StatusNotFound, "application/problem+json"},
+			{"malformed year", "/taxpro/17/012345", nil, http.StatusBadRequest, "application/problem+json"},
+			{"malformed efin", "/taxpro/2017/12345", nil, http.StatusBadRequest, "application/problem+json"},
+			{"backend failure", "/taxpro/2017/012345", errors.New("connection reset"), http.StatusInternalServerError, "application/problem+json"},
+			{"query timeout", "/taxpro/2017/012345", models.ErrQueryTimeout, http.StatusGatewayTimeout, "application/problem+json"},
+			{"query canceled", "/taxpro/2017/012345", models.ErrQueryCanceled, 499, "application/problem+json"},
+		}
+
+		for _, test := range tests {
+			test := test
+			Convey("When the request is "+test.name, func() {
+				repo.err = test.err
+				w := httptest.NewRecorder()
+				taxproRouter().ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+
+				So(w.Code, ShouldEqual, test.status)
+				So(w.Header().Get("Content-Type"), ShouldEqual, test.contentType)
+
+				if test.status == http.StatusOK {
+					var pro models.TaxPro
+					So(json.Unmarshal(w.Body.Bytes(), &pro), ShouldBeNil)
+					So(pro.EFIN, ShouldEqual, "012345")
+				} else {
+					var p problem.Problem
+					So(json.Unmarshal(w.Body.Bytes(), &p), ShouldBeNil)
+					So(p.Status, ShouldEqual, test.status)
+				}
+			})
+		}
+	})
+}
+
+func TestLookupTaxPros(t *testing.T) {
+	Convey("Given the in-memory tax professional repository", t, func() {
+		TaxPros = models.NewMemoryTaxProRepository()
+		saved := MaxLookupBatch
+		MaxLookupBatch = 3
+		defer func() { MaxLookupBatch = saved }()
+
+		r := chi.NewRouter()
+		r.Post("/taxpro/:year/lookup", LookupTaxPros)
+		lookup := func(body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/taxpro/2017/lookup", strings.NewReader(body)))
+			return w
+		}
+
+		Convey("Each EFIN is reported once, found or not, in the order posted", func() {
+			w := lookup(`["654321","999999","012345","654321","654321"]`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			var results []TaxProLookup
+			So(json.Unmarshal(w.Body.Bytes(), &results), ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+			So(results[0].EFIN, ShouldEqual, "654321")
+			So(results[0].Found, ShouldBeTrue)
+			So(results[0].TaxPro.CompanyName, ShouldEqual, "Riverside Bookkeeping")
+			So(results[1].EFIN, ShouldEqual, "999999")
+			So(results[1].Found, ShouldBeFalse)
+			So(results[1].TaxPro, ShouldBeNil)
+			So(results[2].EFIN, ShouldEqual, "012345")
+		})
+
+		tests := []struct {
+			name   string
+			body   string
+			status int
+		}{
+			{"an empty array", `[]`, http.StatusBadRequest},
+			{"not an array", `{"efin":"012345"}`, http.StatusBadRequest},
+			{"too many EFINs", `["012345","123456","654321","111111"]`, http.StatusRequestEntityTooLarge},
+			{"invalid EFINs", `["012345","12345","abcdef"]`, http.StatusBadRequest},
+		}
+		for _, test := range tests {
+			test := test
+			Convey("When the request is "+test.name, func() {
+				w := lookup(test.body)
+				So(w.Code, ShouldEqual, test.status)
+				So(w.Header().Get("Content-Type"), ShouldEqual, "application/problem+json")
+			})
+		}
+
+		Convey("Invalid EFINs are each reported", func() {
+			var p problem.Problem
+			So(json.Unmarshal(lookup(`["012345","12345","abcdef"]`).Body.Bytes(), &p), ShouldBeNil)
+			So(len(p.Errors), ShouldEqual, 2)
+			So(p.Errors[0].Field, ShouldEqual, "efins[1]")
+		})
+	})
+}
+
+func TestTaxProHistory(t *testing.T) {
+	Convey("Given the tax professional routes", t, func() {
+		TaxPros = models.NewMemoryTaxProRepository()
+
+		r := chi.NewRouter()
+		r.Route("/taxpro", func(r chi.Router) {
+			r.Get("/:year/:efin", TaxPro)
+			r.Get("/efin/:efin/history", TaxProHistory)
+		})
+		get := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		Convey("The history lists every year of the EFIN", func() {
+			w := get("/taxpro/efin/012345/history")
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			var history []models.TaxProYear
+			So(json.Unmarshal(w.Body.Bytes(), &history), ShouldBeNil)
+			So(len(history), ShouldEqual, 2)
+			So(history[0].Year, ShouldEqual, "2016")
+			So(history[0].EFIN, ShouldEqual, "012345")
+		})
+
+		Convey("The sibling route still serves a single year", func() {
+			So(get("/taxpro/2017/012345").Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("An EFIN without history is not found", func() {
+			w := get("/taxpro/efin/999999/history")
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/problem+json")
+		})
+
+		Convey("A malformed EFIN is rejected", func() {
+			So(get("/taxpro/efin/12345/history").Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func TestTaxProScope(t *testing.T) {
+	Convey("Given a partner that can only see 2017", t, func() {
+		TaxPros = models.NewMemoryTaxProRepository()
+		taxslayer := &partner.Partner{Name: "taxslayer", Years: []string{"2017"}}
+		principal := &auth.Principal{Subject: "taxslayer", Roles: []string{auth.RolePartner}, Method: "api_key"}
+
+		routes := func(r chi.Router) {
+			r.Get("/:year/:efin", TaxPro)
+			r.Get("/efin/:efin/history", TaxProHistory)
+		}
+		get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		Convey("The partner sees 2017 only", func() {
+			r := chi.NewRouter()
+			r.Use(as(principal, taxslayer))
+			r.Route("/taxpro", routes)
+			So(get(r, "/taxpro/2017/012345").Code, ShouldEqual, http.StatusOK)
+			So(get(r, "/taxpro/2016/012345").Code, ShouldEqual, http.StatusForbidden)
+
+			var history []models.TaxProYear
+			So(json.Unmarshal(get(r, "/taxpro/efin/012345/history").Body.Bytes(), &history), ShouldBeNil)
+			So(len(history), ShouldEqual, 1)
+			So(history[0].Year, ShouldEqual, "2017")
+		})
+
+		Convey("Anonymous callers see every year, whatever partner they claim", func() {
+			r := chi.NewRouter()
+			r.Route("/taxpro", routes)
+			req := httptest.NewRequest("GET", "/taxpro/2016/012345", nil)
+			req.Header.Set("X-Partner", "taxslayer")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(get(r, "/taxpro/efin/012345/history").Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Callers without the partner's API key have the default scope", func() {
+			r := chi.NewRouter()
+			r.Use(as(&auth.Principal{Subject: "taxslayer", Roles: []string{auth.RolePartner}, Method: "jwt"}, nil))
+			r.Route("/taxpro", routes)
+			So(get(r, "/taxpro/2016/012345").Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/giact"
+	"github.com/dstroot/chi_api/logging"
+	"github.com/dstroot/chi_api/partner"
+	"github.com/dstroot/chi_api/problem"
+	"github.com/dstroot/chi_api/validation"
+	"github.com/pressly/chi/middleware"
+	"github.com/pressly/chi/render"
+)
+
+// bankAccountRequest is the payload of a bank account verification.
+type bankAccountRequest struct {
+	RoutingNumber string `json:"routing_number"`
+	AccountNumber string `json:"account_number"`
+	AccountType   string `json:"account_type"` // "checking" or "savings"
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	BusinessName  string `json:"business_name"`
+}
+
+// Validate checks the bank account request fields.
+func (req *bankAccountRequest) Validate() validation.Errors {
+	var errs validation.Errors
+	validation.RoutingNumber(&errs, "routing_number", req.RoutingNumber)
+	validation.Digits(&errs, "account_number", req.AccountNumber, 4, 17)
+	validation.OneOf(&errs, "account_type", req.AccountType, "checking", "savings")
+	if req.BusinessName == "" {
+		validation.Required(&errs, "last_name", req.LastName)
+	}
+	return errs
+}
+
+// BankAccountVerification is the result of verifying a bank account.
+type BankAccountVerification struct {
+	Outcome              giact.Outcome `json:"outcome"`
+	ItemReferenceID      int64         `json:"item_reference_id"`
+	VerificationResponse int           `json:"verification_response"`
+	AccountResponseCode  string        `json:"account_response_code"`
+	BankName             string        `json:"bank_name,omitempty"`
+}
+
+// VerifyBankAccount verifies a bank account with GIACT using the
+// credentials of the requesting partner, and maps the GIACT response
+// to a pass, fail or review outcome. Only a partner's own API key in
+// the partner registry selects its credentials: neither the payload, a
+// header nor another key with the partner's name can.
+func VerifyBankAccount(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.FromContext(r.Context()); !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		problem.Render(w, r, http.StatusUnauthorized, "bank account verification requires a partner API key")
+		return
+	}
+	p, ok := partner.FromContext(r.Context())
+	if !ok || p.Giact == nil {
+		problem.Render(w, r, http.StatusForbidden, "bank account verification requires a partner API key")
+		return
+	}
+
+	var req bankAccountRequest
+	if err := render.Bind(r.Body, &req); err != nil {
+		problem.Render(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		problem.Invalid(w, r, http.StatusUnprocessableEntity, errs)
+		return
+	}
+
+	accountType := giact.Checking
+	if req.AccountType == "savings" {
+		accountType = giact.Savings
+	}
+
+	resp, err := p.Giact.Verify(r.Context(), &giact.Inquiry{
+		UniqueID: middleware.GetReqID(r.Context()),
+		Check: &giact.Check{
+			RoutingNumber: req.RoutingNumber,
+			AccountNumber: req.AccountNumber,
+			AccountType:   accountType,
+		},
+		Customer: &giact.Customer{
+			FirstName:    req.FirstName,
+			LastName:     req.LastName,
+			BusinessName: req.BusinessName,
+		},
+		GVerifyEnabled: true,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("verify bank account", "error", err)
+		problem.Render(w, r, http.StatusBadGateway, "bank account verification is unavailable")
+		return
+	}
+
+	render.JSON(w, r, &BankAccountVerification{
+		Outcome:              resp.Outcome(),
+		ItemReferenceID:      resp.ItemReferenceID,
+		VerificationResponse: int(resp.VerificationResponse),
+		AccountResponseCode:  string(resp.AccountResponseCode),
+		BankName:             resp.BankName,
+	})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/giact"
+	"github.com/dstroot/chi_api/partner"
+	"github.com/dstroot/chi_api/problem"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyBankAccount(t *testing.T) {
+	Convey("Given a GIACT stand-in server per partner", t, func() {
+		var authorization string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			json.NewEncoder(w).Encode(&giact.Response{
+				ItemReferenceID:      7,
+				VerificationResponse: giact.Declined,
+				AccountResponseCode:  "GS02",
+			})
+		}))
+		defer ts.Close()
+
+		Partners = partner.NewRegistry(
+			&partner.Partner{Name: "intuit", APIKeys: []string{"k1"}, Giact: giact.New(ts.URL, "Basic intuit", 0)},
+			&partner.Partner{Name: "taxslayer", APIKeys: []string{"k2"}, Giact: giact.New(ts.URL, "Basic taxslayer", 0)},
+		)
+
+		authenticator := auth.New("test")
+		authenticator.AddAPIKey("k1", "intuit", auth.RolePartner)
+		authenticator.AddAPIKey("k2", "taxslayer", auth.RolePartner)
+
+		verify := func(apiKey string, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/verify/bank-account", strings.NewReader(body))
+			r.Header.Set("X-API-Key", apiKey)
+			authenticator.Handler(Partners.Handler(http.HandlerFunc(VerifyBankAccount))).ServeHTTP(w, r)
+			return w
+		}
+
+		Convey("The partner's credentials are used and the outcome is mapped", func() {
+			w := verify("k2", `{"routing_number":"122105278","account_number":"0000000016","account_type":"checking","last_name":"Smith"}`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(authorization, ShouldEqual, "Basic taxslayer")
+
+			var result BankAccountVerification
+			So(json.Unmarshal(w.Body.Bytes(), &result), ShouldBeNil)
+			So(result.Outcome, ShouldEqual, giact.OutcomeFail)
+			So(result.AccountResponseCode, ShouldEqual, "GS02")
+		})
+
+		Convey("Invalid requests are rejected before calling GIACT", func() {
+			w := verify("k1", `{"routing_number":"123456789","account_number":"12","account_type":"cash"}`)
+			So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			So(authorization, ShouldEqual, "")
+
+			var p problem.Problem
+			So(json.Unmarshal(w.Body.Bytes(), &p), ShouldBeNil)
+			So(len(p.Errors), ShouldEqual, 4)
+		})
+
+		Convey("Requests with an unknown API key are rejected", func() {
+			w := verify("unknown", `{"routing_number":"122105278","account_number":"0000000016","account_type":"checking","last_name":"Smith"}`)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(authorization, ShouldEqual, "")
+		})
+
+		Convey("Anonymous requests are rejected, whatever partner they claim", func() {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/verify/bank-account", strings.NewReader(`{"partner":"taxslayer"}`))
+			r.Header.Set("X-Partner", "taxslayer")
+			r.Host = "taxslayer.api.example.com"
+			authenticator.Handler(Partners.Handler(http.HandlerFunc(VerifyBankAccount))).ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(authorization, ShouldEqual, "")
+		})
+
+		Convey("Partner API keys missing from the partner registry can't use its credentials", func() {
+			authenticator.AddAPIKey("k4", "intuit", auth.RolePartner)
+			w := verify("k4", `{"routing_number":"122105278","account_number":"0000000016","account_type":"checking","last_name":"Smith"}`)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+			So(authorization, ShouldEqual, "")
+		})
+
+		Convey("Callers other than partners can't use partner credentials", func() {
+			authenticator.AddAPIKey("k3", "ops", auth.RoleAdmin)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/verify/bank-account", strings.NewReader(`{}`))
+			r.Header.Set("X-API-Key", "k3")
+			r.Header.Set("X-Partner", "taxslayer")
+			authenticator.Handler(Partners.Handler(http.HandlerFunc(VerifyBankAccount))).ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+			So(authorization, ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,168 @@
+// Package health reports whether the API is alive and whether it's
+// ready to serve traffic. Readiness runs the registered dependency
+// checks concurrently, each with its own timeout.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports whether a dependency is usable. It must give up when
+// the context is done.
+type Check func(ctx context.Context) error
+
+// Statuses of a check or of the whole report.
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Result is the outcome of a check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+
+	// LastError is the most recent failure, even if the check has
+	// passed since.
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Report is the outcome of every check. It's ok when all checks are.
+type Report struct {
+	Status string    `json:"status"`
+	Checks []*Result `json:"checks"`
+}
+
+type check struct {
+	name        string
+	fn          Check
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Checker runs the readiness checks.
+type Checker struct {
+	Timeout time.Duration // per check
+
+	mu     sync.Mutex
+	checks []*check
+}
+
+// New returns a checker that gives each check timeout to complete.
+func New(timeout time.Duration) *Checker {
+	return &Checker{Timeout: timeout}
+}
+
+// Register adds a check.
+func (c *Checker) Register(name string, fn Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, &check{name: name, fn: fn})
+}
+
+// Run runs every check concurrently and waits for all of them.
+func (c *Checker) Run(ctx context.Context) *Report {
+	c.mu.Lock()
+	checks := append([]*check(nil), c.checks...)
+	c.mu.Unlock()
+
+	report := &Report{Status: StatusOK, Checks: make([]*Result, len(checks))}
+	errs := make([]error, len(checks))
+
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk *check) {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = c.run(ctx, chk)
+			report.Checks[i] = &Result{
+				Name:      chk.name,
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+		}(i, chk)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, chk := range checks {
+		result := report.Checks[i]
+		if errs[i] != nil {
+			result.Status = StatusFailing
+			result.Error = errs[i].Error()
+			report.Status = StatusFailing
+			chk.lastError, chk.lastErrorAt = result.Error, time.Now()
+		}
+		if chk.lastError != "" {
+			at := chk.lastErrorAt
+			result.LastError, result.LastErrorAt = chk.lastError, &at
+		}
+	}
+	return report
+}
+
+// run runs a check with the timeout. A check that doesn't return in
+// time fails even if it ignores its context.
+func (c *Checker) run(ctx context.Context, chk *check) (err error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				done <- panicError{rvr}
+			}
+		}()
+		done <- chk.fn(ctx)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
+
+type panicError struct{ v interface{} }
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("check panicked: %v", e.v)
+}
+
+// Handler answers readiness probes with the report, as a 200 when every
+// check passes and a 503 otherwise.
+func (c *Checker) Handler(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// Live answers liveness probes. If we can answer at all we're alive.
+func Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChecker(t *testing.T) {
+	Convey("Given a checker with a passing and a flaky check", t, func() {
+		c := New(50 * time.Millisecond)
+		c.Register("database", func(ctx context.Context) error { return nil })
+		fail := true
+		c.Register("giact", func(ctx context.Context) error {
+			if fail {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+
+		Convey("Readiness fails with the failing check's error", func() {
+			w := httptest.NewRecorder()
+			c.Handler(w, httptest.NewRequest("GET", "/readyz", nil))
+			So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+			var report Report
+			So(json.Unmarshal(w.Body.Bytes(), &report), ShouldBeNil)
+			So(report.Status, ShouldEqual, StatusFailing)
+			So(report.Checks[0].Status, ShouldEqual, StatusOK)
+			So(report.Checks[1].Status, ShouldEqual, StatusFailing)
+			So(report.Checks[1].Error, ShouldEqual, "connection refused")
+		})
+
+		Convey("A recovered check is ok but remembers its last error", func() {
+			c.Run(context.Background())
+			fail = false
+			report := c.Run(context.Background())
+			So(report.Status, ShouldEqual, StatusOK)
+			So(report.Checks[1].Error, ShouldBeEmpty)
+			So(report.Checks[1].LastError, ShouldEqual, "connection refused")
+			So(report.Checks[1].LastErrorAt, ShouldNotBeNil)
+		})
+
+		Convey("Checks run concurrently and time out", func() {
+			for _, name := range []string{"slow1", "slow2", "slow3"} {
+				c.Register(name, func(ctx context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				})
+			}
+			start := time.Now()
+			report := c.Run(context.Background())
+			So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+			So(report.Checks[2].Error, ShouldEqual, context.DeadlineExceeded.Error())
+		})
+	})
+}
@@ -1,26 +1,57 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
-	"log"
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/cors"
 	"github.com/dstroot/chi_api/database"
-	env "github.com/joeshaw/envdecode"
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/dstroot/chi_api/giact"
+	"github.com/dstroot/chi_api/handlers"
+	"github.com/dstroot/chi_api/health"
+	"github.com/dstroot/chi_api/logging"
+	"github.com/dstroot/chi_api/models"
+	"github.com/dstroot/chi_api/partner"
+	"github.com/dstroot/chi_api/ratelimit"
+	"github.com/dstroot/chi_api/tiering"
+	"github.com/dstroot/chi_api/validation"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	cfg Config // global configuration
+	cfg           Config                     // global configuration
+	logger        *logging.Logger            // structured application log
+	authenticator *auth.Authenticator        // checks API keys and bearer tokens
+	readiness     *health.Checker            // dependency checks behind /readyz
+	limiter       *ratelimit.Limiter         // per-client request rates
+	registry      = prometheus.NewRegistry() // served on /metrics
 )
 
 // Config contains the configuration from environment variables
 type Config struct {
-	Debug bool   `env:"DEBUG,default=true"`
-	Port  string `env:"PORT,default=9102"`
-	Site  struct {
+	Debug   bool   `env:"DEBUG,default=true"`
+	Port    string `env:"PORT,default=9102"`
+	Storage string `env:"STORAGE,default=mssql"` // "mssql" or "memory"
+	Log     struct {
+		Format string `env:"LOG_FORMAT,default=json"` // "json" or "text"
+		Level  string `env:"LOG_LEVEL,default=info"`  // "debug", "info", "warn" or "error"
+	}
+	Server struct {
+		ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT,default=5s"`
+		ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT,default=2s"`
+		WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT,default=10s"`
+		IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT,default=120s"`
+		RequestTimeout    time.Duration `env:"SERVER_REQUEST_TIMEOUT,default=2500ms"` // handlers give up after this long
+		MaxHeaderBytes    int           `env:"SERVER_MAX_HEADER_BYTES,default=1048576"`
+		DrainDelay        time.Duration `env:"SERVER_DRAIN_DELAY,default=5s"`       // fail /health this long before closing listeners
+		ShutdownTimeout   time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT,default=30s"` // deadline for in-flight requests
+	}
+	Site struct {
 		Intuit   string `env:"SITE_INTUIT,default=http://localhost:3001"`
 		TaxSayer string `env:"SITE_TAXSLAYER,default=http://localhost:3002"`
 	}
@@ -28,32 +59,84 @@ type Config struct {
 		Host     string `env:"MSSQL_HOST,default=localhost"`
 		Port     string `env:"MSSQL_PORT,default=1433"`
 		User     string `env:"MSSQL_USER,default=admin"`
-		Password string `env:"MSSQL_PASSWORD,default=admin"`
+		Password string `env:"MSSQL_PASSWORD,default=admin" secret:"true"`
 		Database string `env:"MSSQL_DATABASE,default=test"`
+		AppName  string `env:"MSSQL_APP_NAME,default=chi_api"`
+		FullText bool   `env:"MSSQL_FULLTEXT,default=false"` // search with a full-text index
+
+		Encrypt                string `env:"MSSQL_ENCRYPT"` // "true", "false" (login only) or "disable"
+		TrustServerCertificate bool   `env:"MSSQL_TRUST_SERVER_CERTIFICATE,default=false"`
+		Certificate            string `env:"MSSQL_CERTIFICATE"`             // CA certificate file
+		HostNameInCertificate  string `env:"MSSQL_HOSTNAME_IN_CERTIFICATE"` // defaults to MSSQL_HOST
+
+		ConnectionTimeout time.Duration `env:"MSSQL_CONNECTION_TIMEOUT,default=60s"`
+		DialTimeout       time.Duration `env:"MSSQL_DIAL_TIMEOUT,default=10s"`
+		KeepAlive         time.Duration `env:"MSSQL_KEEPALIVE,default=10s"`    // 0 to disable
+		QueryTimeout      time.Duration `env:"MSSQL_QUERY_TIMEOUT,default=2s"` // 0 for none
+
+		MaxOpenConns    int           `env:"MSSQL_MAX_OPEN_CONNS,default=50"` // 0 for no limit
+		MaxIdleConns    int           `env:"MSSQL_MAX_IDLE_CONNS,default=25"`
+		ConnMaxLifetime time.Duration `env:"MSSQL_CONN_MAX_LIFETIME,default=30m"` // 0 to reuse forever
+	}
+	TaxPro struct {
+		MaxLookupBatch int    `env:"TAXPRO_MAX_LOOKUP_BATCH,default=500"`
+		Tiers          string `env:"TAXPRO_TIERS,default=Bronze=0 Silver=100 Gold=250 Premier=500"`
+		TierOverrides  string `env:"TAXPRO_TIER_OVERRIDES"` // e.g. "2015:Bronze=0 Gold=200;2016:..."
+		PremierTier    string `env:"TAXPRO_PREMIER_TIER,default=Gold"`
+		FirstYear      int    `env:"TAXPRO_FIRST_YEAR,default=2014"`
+		LastYear       int    `env:"TAXPRO_LAST_YEAR"` // defaults to the current year
+
+		CacheTTL         time.Duration `env:"TAXPRO_CACHE_TTL,default=24h"`          // closed system years
+		CacheCurrentTTL  time.Duration `env:"TAXPRO_CACHE_CURRENT_TTL,default=1m"`   // the last system year
+		CacheNotFoundTTL time.Duration `env:"TAXPRO_CACHE_NOT_FOUND_TTL,default=1m"` // unknown EFINs
+		CacheSize        int           `env:"TAXPRO_CACHE_SIZE,default=100000"`      // 0 disables the cache
+	}
+	GiactURL           string        `env:"GIACT_URL,default=https://api.giact.com/"`
+	GiactAuthIntuit    string        `env:"GIACT_AUTH_INTUIT,default=Basic..." secret:"true"`
+	GiactAuthTaxSlayer string        `env:"GIACT_AUTH_TAXSLAYER,default=Basic..." secret:"true"`
+	GiactTimeout       time.Duration `env:"GIACT_TIMEOUT,default=2s"`        // shorter than SERVER_REQUEST_TIMEOUT
+	HealthTimeout      time.Duration `env:"HEALTH_CHECK_TIMEOUT,default=2s"` // per readiness check
+	Partner            struct {
+		IntuitAPIKeys    []string `env:"PARTNER_INTUIT_API_KEYS" secret:"true"`    // separated by ";"
+		IntuitYears      []string `env:"PARTNER_INTUIT_YEARS"`                     // empty for all years
+		TaxSlayerAPIKeys []string `env:"PARTNER_TAXSLAYER_API_KEYS" secret:"true"` // separated by ";"
+		TaxSlayerYears   []string `env:"PARTNER_TAXSLAYER_YEARS"`                  // empty for all years
+	}
+	Auth struct {
+		Realm     string   `env:"REALM,default=chi_api"`
+		APIKeys   []string `env:"AUTH_API_KEYS" secret:"true"` // "key=subject:role1,role2" separated by ";"
+		JWTKeys   []string `env:"JWT_KEYS" secret:"true"`      // HS256 keys separated by ";"
+		JWTIssuer string   `env:"JWT_ISSUER"`
+	}
+	RateLimit struct {
+		Limits []string `env:"RATE_LIMITS,default=*:*=600/m;*:verify=30/m"` // "partner:group=100/m" separated by ";", * for any
+	}
+	Page struct {
+		DefaultLimit int `env:"PAGE_DEFAULT_LIMIT,default=20"`
+		MaxLimit     int `env:"PAGE_MAX_LIMIT,default=100"`
+		MaxOffset    int `env:"PAGE_MAX_OFFSET,default=10000"`
+	}
+	CORS struct {
+		AllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS"` // defaults to the partner sites
+		AllowedMethods   []string      `env:"CORS_ALLOWED_METHODS,default=GET;HEAD;POST;PUT;PATCH;DELETE"`
+		AllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS,default=Accept;Authorization;Content-Type;If-Match;If-None-Match;If-Modified-Since;If-Unmodified-Since;X-API-Key;X-Partner"`
+		ExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS,default=ETag;Location;RateLimit-Limit;RateLimit-Remaining;RateLimit-Reset;Retry-After"`
+		AllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS,default=false"`
+		MaxAge           time.Duration `env:"CORS_MAX_AGE,default=10m"`
+		AdminOrigins     []string      `env:"CORS_ADMIN_ALLOWED_ORIGINS"` // none by default
+		AdminMethods     []string      `env:"CORS_ADMIN_ALLOWED_METHODS,default=GET"`
 	}
-	GiactURL           string `env:"GIACT_URL,default=https://api.giact.com/"`
-	GiactAuthIntuit    string `env:"GIACT_AUTH_INTUIT,default=Basic..."`
-	GiactAuthTaxSlayer string `env:"GIACT_AUTH_TAXSLAYER,default=Basic..."`
 }
 
 // setupDatabase connects to our SQL Server
 func setupDatabase() (err error) {
-
-	connString := "server=" + cfg.SQL.Host +
-		";port=" + cfg.SQL.Port +
-		";user id=" + cfg.SQL.User +
-		";password=" + cfg.SQL.Password +
-		";database=" + cfg.SQL.Database +
-		";connection timeout=60" + // in seconds (default is 30)
-		";dial timeout=10" + // in seconds (default is 5)
-		";keepAlive=10" // in seconds; 0 to disable (default is 0)
+	opts := sqlOptions()
 
 	// open connection to SQL Server
-	database.DB, err = sql.Open("mssql", connString)
+	database.DB, err = database.Open(opts)
 	if err != nil {
 		return errors.Wrap(err, "error connecting to database")
 	}
-	database.DB.SetMaxIdleConns(100)
 
 	if cfg.Debug {
 		// The first actual connection to the underlying datastore will be
@@ -63,35 +146,327 @@ func setupDatabase() (err error) {
 		// in), use database.DB.Ping().
 		err = database.DB.Ping()
 		if err != nil {
-			log.Printf("Connection: %s\n", connString)
+			logger.Error("database ping failed", "connection", opts.Redacted())
 			return errors.Wrap(err, "error pinging database")
 		}
 	}
 	return nil
 }
 
+// sqlOptions returns the database options from our configuration.
+func sqlOptions() database.Options {
+	return database.Options{
+		Host:                   cfg.SQL.Host,
+		Port:                   cfg.SQL.Port,
+		User:                   cfg.SQL.User,
+		Password:               cfg.SQL.Password,
+		Database:               cfg.SQL.Database,
+		AppName:                cfg.SQL.AppName,
+		Encrypt:                cfg.SQL.Encrypt,
+		TrustServerCertificate: cfg.SQL.TrustServerCertificate,
+		Certificate:            cfg.SQL.Certificate,
+		HostNameInCertificate:  cfg.SQL.HostNameInCertificate,
+		ConnectionTimeout:      cfg.SQL.ConnectionTimeout,
+		DialTimeout:            cfg.SQL.DialTimeout,
+		KeepAlive:              cfg.SQL.KeepAlive,
+		MaxOpenConns:           cfg.SQL.MaxOpenConns,
+		MaxIdleConns:           cfg.SQL.MaxIdleConns,
+		ConnMaxLifetime:        cfg.SQL.ConnMaxLifetime,
+	}
+}
+
 // initialize our configuration from environment variables.
 func initialize() error {
 
-	// For development, github.com/joho/godotenv/autoload
-	// loads env variables from .env file for you.
+	// For development, load env variables from the .env file
+	err := loadDotEnv()
+	if err != nil {
+		return err
+	}
 
-	// Read configuration from env variables
-	err := env.Decode(&cfg)
+	// Read configuration from env variables and *_FILE secrets
+	err = loadConfig(&cfg)
 	if err != nil {
-		return errors.Wrap(err, "configuration decode failed")
+		return err
+	}
+
+	err = setupLogging()
+	if err != nil {
+		return errors.Wrap(err, "logging setup failed")
 	}
 
 	// log configuration for debugging
 	if cfg.Debug {
-		prettyCfg, _ := json.MarshalIndent(cfg, "", "  ")
-		log.Printf("Configuration: \n%v", string(prettyCfg))
+		logger.Info("configuration", "config", redactedConfig())
 	}
 
-	err1 := setupDatabase()
+	setupHandlers()
+
+	err1 := setupRepositories()
 	if err1 != nil {
-		return errors.Wrap(err1, "database connection failed")
+		return errors.Wrap(err1, "repository setup failed")
 	}
 
+	setupPartners()
+
+	err2 := setupAuth()
+	if err2 != nil {
+		return errors.Wrap(err2, "authentication setup failed")
+	}
+
+	err3 := setupRateLimits()
+	if err3 != nil {
+		return errors.Wrap(err3, "rate limit setup failed")
+	}
+
+	setupHealth()
+	setupMetrics()
+
+	return nil
+}
+
+// setupLogging creates our logger in the configured format and level.
+func setupLogging() error {
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	logger, err = logging.New(os.Stdout, cfg.Log.Format, level)
+	if err != nil {
+		return err
+	}
+	logging.Default = logger
 	return nil
 }
+
+// setupHandlers applies the request limits from our configuration.
+func setupHandlers() {
+	handler.MaxLookupBatch = cfg.TaxPro.MaxLookupBatch
+	handler.DefaultPageLimit = cfg.Page.DefaultLimit
+	handler.MaxPageLimit = cfg.Page.MaxLimit
+	handler.MaxPageOffset = cfg.Page.MaxOffset
+	validation.Years = validation.YearRange{
+		First: cfg.TaxPro.FirstYear,
+		Last:  cfg.TaxPro.LastYear,
+	}
+}
+
+// setupRepositories selects the storage backing our handlers. The
+// "memory" storage uses seeded fixture data and needs no SQL Server,
+// which is handy for local development.
+func setupRepositories() error {
+	tiers, err := setupTiers()
+	if err != nil {
+		return err
+	}
+
+	models.QueryTimeout = cfg.SQL.QueryTimeout
+
+	var taxpros models.TaxProRepository
+	switch cfg.Storage {
+	case "memory":
+		taxpros = models.NewMemoryTaxProRepository()
+		handler.Articles = models.NewMemoryArticleStore()
+	case "mssql":
+		err = setupDatabase()
+		if err != nil {
+			return err
+		}
+		taxpros = models.NewSQLTaxProRepository(database.DB)
+
+		articles := models.NewSQLArticleStore(database.DB)
+		articles.FullText = cfg.SQL.FullText
+		if err = articles.Migrate(context.Background()); err != nil {
+			return err
+		}
+		handler.Articles = articles
+	default:
+		return errors.Errorf("unknown storage %q", cfg.Storage)
+	}
+	if cfg.TaxPro.CacheSize > 0 {
+		cache := models.NewCachedTaxProRepository(taxpros, cfg.TaxPro.CacheTTL, cfg.TaxPro.CacheCurrentTTL, cfg.TaxPro.CacheNotFoundTTL)
+		cache.CurrentYear = cfg.TaxPro.LastYear
+		cache.MaxEntries = cfg.TaxPro.CacheSize
+		handler.TaxProCache = cache
+		taxpros = cache
+	}
+	handler.TaxPros = models.NewTieredTaxProRepository(taxpros, tiers)
+
+	return nil
+}
+
+// setupTiers builds the premier partner tiering rules from our configuration.
+func setupTiers() (*tiering.Engine, error) {
+	rules, err := tiering.ParseRules(cfg.TaxPro.Tiers)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TAXPRO_TIERS")
+	}
+	overrides, err := tiering.ParseOverrides(cfg.TaxPro.TierOverrides)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TAXPRO_TIER_OVERRIDES")
+	}
+	return tiering.New(rules, overrides, cfg.TaxPro.PremierTier)
+}
+
+// setupPartners registers our partners with their site, API keys,
+// data scope and GIACT credentials.
+func setupPartners() {
+	handler.Partners = partner.NewRegistry(
+		&partner.Partner{
+			Name:    "intuit",
+			Site:    cfg.Site.Intuit,
+			Years:   cfg.Partner.IntuitYears,
+			APIKeys: cfg.Partner.IntuitAPIKeys,
+			Giact:   giact.New(cfg.GiactURL, cfg.GiactAuthIntuit, cfg.GiactTimeout),
+		},
+		&partner.Partner{
+			Name:    "taxslayer",
+			Site:    cfg.Site.TaxSayer,
+			Years:   cfg.Partner.TaxSlayerYears,
+			APIKeys: cfg.Partner.TaxSlayerAPIKeys,
+			Giact:   giact.New(cfg.GiactURL, cfg.GiactAuthTaxSlayer, cfg.GiactTimeout),
+		},
+	)
+}
+
+// setupAuth configures the API keys and JWT keys used to authenticate
+// requests. Partner API keys authenticate with the partner role.
+func setupAuth() error {
+	authenticator = auth.New(cfg.Auth.Realm)
+	authenticator.Issuer = cfg.Auth.JWTIssuer
+	for _, key := range cfg.Auth.JWTKeys {
+		authenticator.JWTKeys = append(authenticator.JWTKeys, []byte(key))
+	}
+	for _, def := range cfg.Auth.APIKeys {
+		if err := authenticator.ParseAPIKey(def); err != nil {
+			return errors.Wrap(err, "invalid AUTH_API_KEYS")
+		}
+	}
+	for _, p := range handler.Partners.List() {
+		for _, key := range p.APIKeys {
+			authenticator.AddAPIKey(key, p.Name, auth.RolePartner)
+		}
+	}
+	return nil
+}
+
+// setupRateLimits creates the limiter of each client's request rate.
+func setupRateLimits() error {
+	limits, err := ratelimit.ParseLimits(cfg.RateLimit.Limits)
+	if err != nil {
+		return errors.Wrap(err, "invalid RATE_LIMITS")
+	}
+	limiter = ratelimit.New(limits)
+	return nil
+}
+
+// corsPolicy builds the CORS policy for the partner front-ends. The
+// admin routes get their own, stricter, policy.
+func corsPolicy() *cors.Policy {
+	origins := cfg.CORS.AllowedOrigins
+	if len(origins) == 0 {
+		origins = []string{cfg.Site.Intuit, cfg.Site.TaxSayer}
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}).Override("/admin", cors.Options{
+		AllowedOrigins:   cfg.CORS.AdminOrigins,
+		AllowedMethods:   cfg.CORS.AdminMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	})
+}
+
+// setupHealth registers the readiness checks: draining, the database
+// when we use one, and the GIACT endpoint.
+func setupHealth() {
+	readiness = health.New(cfg.HealthTimeout)
+	readiness.Register("shutdown", func(context.Context) error {
+		if atomic.LoadInt32(&draining) == 1 {
+			return errors.New("draining")
+		}
+		return nil
+	})
+	if database.DB != nil {
+		readiness.Register("database", database.DB.PingContext)
+	}
+	// the partners share one GIACT endpoint and pinging it needs no
+	// credentials, so it's checked once
+	readiness.Register("giact", giact.New(cfg.GiactURL, "", cfg.GiactTimeout).Ping)
+}
+
+// setupMetrics exposes the connection pool statistics and times every
+// SQL query.
+func setupMetrics() {
+	queries := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "SQL query latency.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "SQL queries that failed.",
+	}, []string{"query"})
+	registry.MustRegister(queries, failures)
+	models.QueryObserver = func(query string, elapsed time.Duration, failed bool) {
+		queries.WithLabelValues(query).Observe(elapsed.Seconds())
+		if failed {
+			failures.WithLabelValues(query).Inc()
+		}
+	}
+
+	if cache := handler.TaxProCache; cache != nil {
+		registry.MustRegister(
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "taxpro_cache_hits_total",
+				Help: "Tax professional lookups answered from the cache.",
+			}, func() float64 { return float64(cache.Hits()) }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "taxpro_cache_misses_total",
+				Help: "Tax professional lookups that missed the cache.",
+			}, func() float64 { return float64(cache.Misses()) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "taxpro_cache_entries",
+				Help: "Cached tax professional lookups.",
+			}, func() float64 { return float64(cache.Len()) }),
+		)
+	}
+
+	if database.DB == nil {
+		return
+	}
+	stats := database.DB.Stats
+	registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "db_max_open_connections",
+			Help: "Maximum open connections to the database.",
+		}, func() float64 { return float64(stats().MaxOpenConnections) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "db_open_connections",
+			Help: "Open connections to the database.",
+		}, func() float64 { return float64(stats().OpenConnections) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "db_in_use_connections",
+			Help: "Connections in use.",
+		}, func() float64 { return float64(stats().InUse) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "db_idle_connections",
+			Help: "Idle connections.",
+		}, func() float64 { return float64(stats().Idle) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "db_wait_count_total",
+			Help: "Connections waited for.",
+		}, func() float64 { return float64(stats().WaitCount) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "db_wait_duration_seconds_total",
+			Help: "Time spent waiting for connections.",
+		}, func() float64 { return stats().WaitDuration.Seconds() }),
+	)
+}
@@ -7,12 +7,15 @@ import (
 	"testing"
 
 	"github.com/dstroot/chi_api/database"
-	_ "github.com/joho/godotenv/autoload"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 func TestInitialize(t *testing.T) {
 	Convey("Initialize", t, func() {
+		Convey("Should load the .env file", func() {
+			So(loadDotEnv(), ShouldBeNil)
+		})
+
 		Convey("Should initialize our configuration", func() {
 			fmt.Printf("\n\n")
 			err := initialize()
@@ -0,0 +1,251 @@
+// Package logging writes leveled, structured log lines as JSON or as
+// logfmt text. Each request gets a logger carrying its correlation
+// fields, so every line logged while serving it can be tied together.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pressly/chi/middleware"
+)
+
+// Level is the severity of a log line.
+type Level int32
+
+// Levels, from the most to the least verbose.
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name such as "info".
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q", s)
+}
+
+// Formats of log lines.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// output is shared by a logger and the loggers derived from it.
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	level  int32
+	now    func() time.Time
+}
+
+// Logger writes log lines with a set of fields. Loggers are safe for
+// concurrent use.
+type Logger struct {
+	out *output
+
+	mu     sync.Mutex
+	fields []interface{} // alternating keys and values
+}
+
+// New returns a logger writing lines in format at level and above.
+func New(w io.Writer, format string, level Level) (*Logger, error) {
+	if format != FormatJSON && format != FormatText {
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return &Logger{out: &output{w: w, format: format, level: int32(level), now: time.Now}}, nil
+}
+
+// Default is used when no logger has been set up, e.g. in tests.
+var Default = &Logger{out: &output{w: os.Stderr, format: FormatText, level: int32(Info), now: time.Now}}
+
+// SetLevel changes the level of the logger and of every logger derived
+// from it.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.out.level, int32(level))
+}
+
+// Level returns the logger's level.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.out.level))
+}
+
+// Enabled reports whether lines at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// With returns a logger that adds key/value pairs to every line.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	return &Logger{out: l.out, fields: append(fields, kv...)}
+}
+
+// Set adds or replaces a field of the logger itself, rather than of a
+// derived logger.
+func (l *Logger) Set(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		if l.fields[i] == key {
+			l.fields[i+1] = value
+			return
+		}
+	}
+	l.fields = append(l.fields, key, value)
+}
+
+// Debug logs a message with key/value pairs at debug level.
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(Debug, msg, kv) }
+
+// Info logs a message with key/value pairs at info level.
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(Info, msg, kv) }
+
+// Warn logs a message with key/value pairs at warn level.
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(Warn, msg, kv) }
+
+// Error logs a message with key/value pairs at error level.
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(Error, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	l.mu.Lock()
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	fields = append(fields, "time", l.out.now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(fields, l.fields...)
+	l.mu.Unlock()
+	fields = append(fields, kv...)
+	if len(fields)%2 == 1 {
+		fields = append(fields, "(missing)")
+	}
+
+	var buf bytes.Buffer
+	if l.out.format == FormatJSON {
+		writeJSON(&buf, fields)
+	} else {
+		writeText(&buf, fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+// value makes a field value printable.
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(fmt.Sprint(fields[i]))
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(value(fields[i+1]))
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(fields[i+1]))
+		}
+		buf.Write(v)
+	}
+	buf.WriteString("}\n")
+}
+
+func writeText(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(fields[i]))
+		buf.WriteByte('=')
+		var s string
+		switch v := value(fields[i+1]).(type) {
+		case string:
+			s = v
+		case bool, int, int32, int64, uint, uint32, uint64, float32, float64, nil:
+			s = fmt.Sprint(v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				b = []byte(fmt.Sprint(v))
+			}
+			s = string(b)
+		}
+		if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+	buf.WriteByte('\n')
+}
+
+// key is the context key for a logger.
+type key struct{}
+
+// NewContext returns a context carrying a logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, key{}, l)
+}
+
+// FromContext returns the logger of a request, or Default.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(key{}).(*Logger); ok {
+		return l
+	}
+	if e, ok := ctx.Value(middleware.LogEntryCtxKey).(*entry); ok {
+		return e.logger
+	}
+	return Default
+}
+
+// AddField adds a correlation field to the logger of a request, so it's
+// on every line logged from then on, including the request line. It's
+// how middleware later in the chain, such as the partner lookup, adds
+// what it learns. Contexts without a request logger are left alone.
+func AddField(ctx context.Context, key string, value interface{}) {
+	if l := FromContext(ctx); l != Default {
+		l.Set(key, value)
+	}
+}
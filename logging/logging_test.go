@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestLogger(format string, level Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l, err := New(&buf, format, level)
+	So(err, ShouldBeNil)
+	l.out.now = func() time.Time { return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return l, &buf
+}
+
+func TestLogger(t *testing.T) {
+	Convey("Given a JSON logger at info level", t, func() {
+		l, buf := newTestLogger(FormatJSON, Info)
+
+		Convey("Lines are JSON objects with the logger's fields", func() {
+			l.With("request_id", "abc").Error("load article", "error", errors.New("timeout"), "id", 7)
+
+			var line map[string]interface{}
+			So(json.Unmarshal(buf.Bytes(), &line), ShouldBeNil)
+			So(line, ShouldResemble, map[string]interface{}{
+				"time":       "2017-01-02T03:04:05Z",
+				"level":      "error",
+				"msg":        "load article",
+				"request_id": "abc",
+				"error":      "timeout",
+				"id":         float64(7),
+			})
+		})
+
+		Convey("Lines below the level are dropped until the level changes", func() {
+			child := l.With("a", 1)
+			child.Debug("hidden")
+			So(buf.Len(), ShouldEqual, 0)
+
+			l.SetLevel(Debug)
+			child.Debug("shown")
+			So(buf.String(), ShouldContainSubstring, `"msg":"shown"`)
+		})
+	})
+
+	Convey("Text lines are logfmt", t, func() {
+		l, buf := newTestLogger(FormatText, Info)
+		l.Info("listening", "addr", ":8000", "note", "two words")
+		So(buf.String(), ShouldEqual, `time=2017-01-02T03:04:05Z level=info msg=listening addr=:8000 note="two words"`+"\n")
+	})
+
+	Convey("Unknown formats and levels are rejected", t, func() {
+		_, err := New(&bytes.Buffer{}, "xml", Info)
+		So(err, ShouldNotBeNil)
+		_, err = ParseLevel("loud")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRequests(t *testing.T) {
+	Convey("Given a router logging requests", t, func() {
+		l, buf := newTestLogger(FormatJSON, Info)
+		r := chi.NewRouter()
+		r.Use(middleware.RequestID)
+		r.Use(Requests(l))
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				AddField(r.Context(), "partner", "intuit")
+				next.ServeHTTP(w, r)
+			})
+		})
+		r.Get("/taxpro/:year/:efin", func(w http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Warn("slow lookup")
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("short and stout"))
+		})
+
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/taxpro/2017/012345", nil))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		So(len(lines), ShouldEqual, 2)
+
+		var handler, request map[string]interface{}
+		So(json.Unmarshal([]byte(lines[0]), &handler), ShouldBeNil)
+		So(json.Unmarshal([]byte(lines[1]), &request), ShouldBeNil)
+
+		Convey("Handler lines carry the correlation fields", func() {
+			So(handler["request_id"], ShouldNotBeEmpty)
+			So(handler["partner"], ShouldEqual, "intuit")
+		})
+
+		Convey("The request line has the route, status and size", func() {
+			So(request["request_id"], ShouldEqual, handler["request_id"])
+			So(request["level"], ShouldEqual, "warn")
+			So(request["route"], ShouldEqual, "/taxpro/:year/:efin")
+			So(request["status"], ShouldEqual, http.StatusTeapot)
+			So(request["bytes"], ShouldEqual, len("short and stout"))
+			So(request["partner"], ShouldEqual, "intuit")
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dstroot/chi_api/route"
+	"github.com/pressly/chi/middleware"
+)
+
+// Requests is a request logging middleware in place of chi's
+// middleware.Logger. Every request gets a logger with its request ID
+// and real IP, which handlers get back with FromContext, and one line
+// is logged when it completes.
+func Requests(l *Logger) func(next http.Handler) http.Handler {
+	return middleware.RequestLogger(&formatter{logger: l})
+}
+
+// formatter is a chi LogFormatter writing structured lines.
+type formatter struct {
+	logger *Logger
+}
+
+func (f *formatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	return &entry{
+		request: r,
+		logger: f.logger.With(
+			"request_id", middleware.GetReqID(r.Context()),
+			"remote_ip", r.RemoteAddr,
+		),
+	}
+}
+
+// entry is the log entry of a request.
+type entry struct {
+	request *http.Request
+	logger  *Logger
+}
+
+// Write logs the completed request. Server errors are logged as
+// errors, client errors as warnings.
+func (e *entry) Write(status, bytes int, elapsed time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	level := Info
+	switch {
+	case status >= 500:
+		level = Error
+	case status >= 400:
+		level = Warn
+	}
+	r := e.request
+	e.logger.log(level, "request", []interface{}{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"route", route.Pattern(r),
+		"status", status,
+		"bytes", bytes,
+		"duration_ms", float64(elapsed) / float64(time.Millisecond),
+	})
+}
+
+// Panic logs a recovered panic with its stack trace.
+func (e *entry) Panic(v interface{}, stack []byte) {
+	e.logger.Error("panic", "panic", v, "stack", string(stack))
+}
@@ -2,14 +2,17 @@ package main
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/dstroot/chi_api/handlers"
+	"github.com/dstroot/chi_api/health"
+	"github.com/dstroot/chi_api/logging"
+	"github.com/dstroot/chi_api/metrics"
+	"github.com/dstroot/chi_api/problem"
 	"github.com/dstroot/utility"
-	"github.com/goware/httpcoala"
 	"github.com/pressly/chi"
 	"github.com/pressly/chi/docgen"
 	"github.com/pressly/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/russross/blackfriday"
 )
 
@@ -19,6 +22,8 @@ func main() {
 	utility.Check(err)
 
 	r := chi.NewRouter()
+	r.NotFound(problem.NotFound)
+	r.MethodNotAllowed(problem.MethodNotAllowed)
 
 	/**
 	 * MIDDLEWARE
@@ -30,44 +35,89 @@ func main() {
 	// of parsing either the X-Forwarded-For header or the X-Real-IP header (in that
 	// order).
 	r.Use(middleware.RealIP)
-	// Logs the start and end of each request with the elapsed processing time.
-	r.Use(middleware.Logger)
-	// Gracefully absorb panics and prints the stack trace.
-	r.Use(middleware.Recoverer)
+	// Logs each request as a structured line with its route, status and
+	// timing, and gives handlers a logger with the request's correlation
+	// fields.
+	r.Use(logging.Requests(logger))
+	// Gracefully absorb panics, print the stack trace and answer with a
+	// problem.
+	r.Use(problem.Recoverer)
+	// Count requests and time them by route pattern.
+	r.Use(metrics.NewHTTP(registry).Handler)
+	// Answer CORS preflight requests and allow the partner front-ends
+	// to call us from the browser.
+	r.Use(corsPolicy().Handler)
 	// When a client closes their connection midway through a request, the
 	// http.CloseNotifier will cancel the request context (ctx).
 	r.Use(middleware.CloseNotify)
-	// Stop processing after 2.5 seconds.
-	r.Use(middleware.Timeout(2500 * time.Millisecond))
-	// Only one request will be processed at a time.
+	// Health route for Heartbeat/load balancers, failing while we drain
+	r.Use(heartbeat("/health"))
+	// Probes for the orchestrator: liveness and dependency readiness.
+	// Like the heartbeat they come before the throttle, the timeout
+	// and authentication so a busy server isn't restarted.
+	r.Use(probe("/livez", health.Live))        // GET /livez
+	r.Use(probe("/readyz", readiness.Handler)) // GET /readyz
+	// Stop processing after the request timeout, 2.5 seconds by
+	// default.
+	r.Use(problem.Timeout(cfg.Server.RequestTimeout))
+	// At most 25 requests are processed at a time, whoever they come
+	// from. Each client's rate is limited per route group below.
 	r.Use(middleware.Throttle(25))
-	// Middleware handler that routes multiple requests for the
-	// same URI (and routed methods) to be processed as a single request.
-	r.Use(httpcoala.Route("HEAD", "GET")) // or, Route("*")
-	// Health route for Heartbeat/load balancers
-	r.Use(middleware.Heartbeat("/health"))
+	// Authenticate API keys and JWT bearer tokens, and put the
+	// principal on the request context. Responses are never shared
+	// between requests as they depend on the caller: its data scope,
+	// its rate limit and the validators it sent.
+	r.Use(authenticator.Handler)
+	// Resolve the partner making the request from its API key,
+	// X-Partner header or subdomain. Only a verified API key gives a
+	// partner's credentials and data scope.
+	r.Use(handler.Partners.Handler)
 
 	/**
 	 * ROUTES
 	 */
 
+	// Prometheus scrapes
+	r.Get("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP) // GET /metrics
+
 	// RESTy routes for "articles" resource
 	r.Route("/articles", func(r chi.Router) {
+		r.Use(limiter.Handler("articles"))
 		r.With(handler.Paginate).Get("/", handler.ListArticles)
 		r.Post("/", handler.CreateArticle)       // POST /articles
-		r.Get("/search", handler.SearchArticles) // GET /articles/search
+		r.Get("/search", handler.SearchArticles) // GET /articles/search?q=hello&sort=-score
 
 		r.Route("/:articleID", func(r chi.Router) {
 			r.Use(handler.ArticleCtx)            // Load the *Article on the request context
 			r.Get("/", handler.GetArticle)       // GET /articles/123
+			r.Head("/", handler.GetArticle)      // HEAD /articles/123
 			r.Put("/", handler.UpdateArticle)    // PUT /articles/123
+			r.Patch("/", handler.PatchArticle)   // PATCH /articles/123
 			r.Delete("/", handler.DeleteArticle) // DELETE /articles/123
 		})
 	})
 
 	// RESTy routes for tax professionals
 	r.Route("/taxpro", func(r chi.Router) {
-		r.Get("/:year/:efin", handler.TaxPro)
+		r.Use(limiter.Handler("taxpro"))
+		r.With(handler.Paginate).Get("/:year", handler.ListTaxPros)           // GET /taxpro/2017
+		r.With(handler.Paginate).Head("/:year", handler.ListTaxPros)          // HEAD /taxpro/2017
+		r.With(handler.Paginate).Get("/:year/search", handler.SearchTaxPros)  // GET /taxpro/2017/search?q=acme
+		r.With(handler.Paginate).Head("/:year/search", handler.SearchTaxPros) // HEAD /taxpro/2017/search?q=acme
+		r.Post("/:year/lookup", handler.LookupTaxPros)                        // POST /taxpro/2017/lookup
+		r.Get("/:year/:efin", handler.TaxPro)                                 // GET /taxpro/2017/012345
+		r.Head("/:year/:efin", handler.TaxPro)                                // HEAD /taxpro/2017/012345
+		r.Get("/efin/:efin/history", handler.TaxProHistory)                   // GET /taxpro/efin/012345/history
+		r.Head("/efin/:efin/history", handler.TaxProHistory)                  // HEAD /taxpro/efin/012345/history
+	})
+
+	// Configured partners
+	r.With(limiter.Handler("partners")).Get("/partners", handler.ListPartners) // GET /partners
+
+	// Bank account verification through GIACT
+	r.Route("/verify", func(r chi.Router) {
+		r.Use(limiter.Handler("verify"))
+		r.Post("/bank-account", handler.VerifyBankAccount) // POST /verify/bank-account
 	})
 
 	// Mount the admin sub-router, the same as a call to
@@ -89,5 +139,6 @@ func main() {
 	 * SERVER
 	 */
 
-	http.ListenAndServe(":"+cfg.Port, r)
+	err = serve(newServer(r))
+	utility.Check(err)
 }
@@ -0,0 +1,69 @@
+// Package metrics instruments our HTTP routes for Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dstroot/chi_api/route"
+	"github.com/pressly/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Unmatched is the route label of requests that matched no route.
+const Unmatched = "unmatched"
+
+// HTTP instruments requests by chi route pattern, so /taxpro/2017/012345
+// and /taxpro/2016/123456 are both counted as /taxpro/:year/:efin.
+type HTTP struct {
+	Requests *prometheus.CounterVec   // by method, route and status
+	Latency  *prometheus.HistogramVec // by method and route
+	InFlight prometheus.Gauge
+}
+
+// NewHTTP registers the HTTP metrics with reg.
+func NewHTTP(reg prometheus.Registerer) *HTTP {
+	m := &HTTP{
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served.",
+		}, []string{"method", "route", "status"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served.",
+		}),
+	}
+	reg.MustRegister(m.Requests, m.Latency, m.InFlight)
+	return m
+}
+
+// Handler is the middleware recording the metrics. It should come
+// after the Recoverer so panics are counted as 500s.
+func (m *HTTP) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.InFlight.Inc()
+		defer m.InFlight.Dec()
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// the route is only known once chi has routed the request
+		pattern := route.Pattern(r)
+		if pattern == "" {
+			pattern = Unmatched
+		}
+		m.Requests.WithLabelValues(r.Method, pattern, strconv.Itoa(status)).Inc()
+		m.Latency.WithLabelValues(r.Method, pattern).Observe(time.Since(start).Seconds())
+	})
+}
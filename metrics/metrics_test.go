@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pressly/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// scrape returns the registry's metrics in the Prometheus text format.
+func scrape(reg *prometheus.Registry) string {
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestHTTP(t *testing.T) {
+	Convey("Given an instrumented router", t, func() {
+		reg := prometheus.NewRegistry()
+		m := NewHTTP(reg)
+		r := chi.NewRouter()
+		r.Use(m.Handler)
+
+		var inFlight string
+		h := func(w http.ResponseWriter, r *http.Request) {
+			inFlight = scrape(reg)
+		}
+		r.Route("/taxpro", func(r chi.Router) {
+			r.Get("/:year", h)
+			r.Get("/:year/search", h)
+			r.Get("/:year/:efin", h)
+		})
+		r.Route("/articles", func(r chi.Router) {
+			r.Get("/", h)
+			r.Route("/:articleID", func(r chi.Router) {
+				r.Get("/", h)
+			})
+		})
+
+		serve := func(path string) {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+
+		Convey("Requests are labelled by the pattern chi routed them to", func() {
+			serve("/taxpro/2017/012345")
+			serve("/taxpro/2016/123456")
+			serve("/taxpro/2017/search")
+			serve("/articles")
+			serve("/articles/7")
+			serve("/nope")
+
+			out := scrape(reg)
+			So(out, ShouldContainSubstring, `http_requests_total{method="GET",route="/taxpro/:year/:efin",status="200"} 2`)
+			So(out, ShouldContainSubstring, `http_requests_total{method="GET",route="/taxpro/:year/search",status="200"} 1`)
+			So(out, ShouldContainSubstring, `http_requests_total{method="GET",route="/articles",status="200"} 1`)
+			So(out, ShouldContainSubstring, `http_requests_total{method="GET",route="/articles/:articleID",status="200"} 1`)
+			So(out, ShouldContainSubstring, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+			So(out, ShouldContainSubstring, `http_request_duration_seconds_count{method="GET",route="/taxpro/:year/:efin"} 2`)
+		})
+
+		Convey("In-flight requests are tracked", func() {
+			serve("/taxpro/2017/012345")
+			So(inFlight, ShouldContainSubstring, "http_requests_in_flight 1\n")
+			So(scrape(reg), ShouldContainSubstring, "http_requests_in_flight 0\n")
+		})
+	})
+}
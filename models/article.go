@@ -0,0 +1,358 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/validation"
+	"github.com/pkg/errors"
+)
+
+// ErrArticleNotFound is returned when an article does not exist.
+var ErrArticleNotFound = errors.New("article not found")
+
+// ErrVersionConflict is returned when an article being saved has
+// changed since the version it was read at.
+var ErrVersionConflict = errors.New("article version conflict")
+
+// Article struct
+type Article struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+
+	// Version counts the changes to the article, starting at 1. Saves
+	// must be made against the current version.
+	Version int64 `json:"version"`
+
+	// UpdatedAt is when the article last changed. It's served as the
+	// Last-Modified header rather than in the body.
+	UpdatedAt time.Time `json:"-"`
+}
+
+// Validate checks the fields a client can set on an Article.
+func (a *Article) Validate() validation.Errors {
+	var errs validation.Errors
+	validation.Required(&errs, "title", a.Title)
+	validation.MaxLength(&errs, "title", a.Title, 255)
+	return errs
+}
+
+// ArticleStore is the storage for articles.
+type ArticleStore interface {
+	// ListArticles returns a page of articles ordered by ID.
+	ListArticles(ctx context.Context, q PageQuery) ([]*Article, error)
+
+	// GetArticle returns the article with the given ID, or ErrArticleNotFound.
+	GetArticle(ctx context.Context, id string) (*Article, error)
+
+	// CreateArticle stores a new article and assigns its ID.
+	CreateArticle(ctx context.Context, article *Article) error
+
+	// UpdateArticle saves the changes to an existing article, provided
+	// its Version is still the stored one, or returns
+	// ErrVersionConflict. The article gets its new Version.
+	UpdateArticle(ctx context.Context, article *Article) error
+
+	// DeleteArticle removes an article and returns it, provided it's
+	// still at the given version, or returns ErrVersionConflict.
+	DeleteArticle(ctx context.Context, id string, version int64) (*Article, error)
+
+	ArticleSearcher
+}
+
+// SQLArticleStore is an ArticleStore backed by SQL Server. IDs come
+// from an IDENTITY column so they never collide.
+type SQLArticleStore struct {
+	DB *sql.DB
+
+	// FullText searches with CONTAINSTABLE, which needs a full-text
+	// index on dbo.articles(title). Otherwise searches use LIKE and
+	// match the way MemoryArticleStore does.
+	FullText bool
+}
+
+// NewSQLArticleStore returns a store that uses the given database.
+func NewSQLArticleStore(db *sql.DB) *SQLArticleStore {
+	return &SQLArticleStore{DB: db}
+}
+
+// createArticles creates the articles table if it doesn't exist yet.
+const createArticles = `
+	IF OBJECT_ID('dbo.articles', 'U') IS NULL
+	CREATE TABLE dbo.articles (
+		id         BIGINT IDENTITY(1,1) NOT NULL PRIMARY KEY,
+		title      NVARCHAR(255) NOT NULL,
+		created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+		updated_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+	);
+	IF COL_LENGTH('dbo.articles', 'version') IS NULL
+	ALTER TABLE dbo.articles ADD version BIGINT NOT NULL DEFAULT 1;`
+
+// Migrate creates the tables used by the store.
+func (store *SQLArticleStore) Migrate(ctx context.Context) (err error) {
+	ctx, done := startQuery(ctx, "articles.migrate")
+	defer done(&err)
+
+	_, err = store.DB.ExecContext(ctx, createArticles)
+	return errors.Wrap(err, "migrating articles")
+}
+
+// ListArticles returns a page of articles
+func (store *SQLArticleStore) ListArticles(ctx context.Context, q PageQuery) (_ []*Article, err error) {
+	ctx, done := startQuery(ctx, "articles.list")
+	defer done(&err)
+
+	limit := q.Limit
+	if limit == 0 {
+		limit = math.MaxInt32
+	}
+
+	var rows *sql.Rows
+	switch {
+	case q.After != "":
+		rows, err = store.DB.QueryContext(ctx, `
+		SELECT TOP(?) id, title, version FROM dbo.articles
+		WHERE id > ? ORDER BY id;`, limit, articleKey(q.After))
+	case q.Before != "":
+		// walk backwards from the key, then put the page back in order
+		rows, err = store.DB.QueryContext(ctx, `
+		SELECT id, title, version FROM (
+			SELECT TOP(?) id, title, version FROM dbo.articles
+			WHERE id < ? ORDER BY id DESC
+		) AS page ORDER BY id;`, limit, articleKey(q.Before))
+	default:
+		rows, err = store.DB.QueryContext(ctx, `
+		SELECT id, title, version FROM dbo.articles ORDER BY id
+		OFFSET ? ROWS FETCH NEXT ? ROWS ONLY;`, q.Offset, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*Article, 0)
+
+	for rows.Next() {
+		article := new(Article)
+		err1 := rows.Scan(&article.ID, &article.Title, &article.Version)
+		if err1 != nil {
+			return nil, err1
+		}
+		results = append(results, article)
+	}
+	if err2 := rows.Err(); err2 != nil {
+		return nil, err2
+	}
+	return results, nil
+}
+
+// articleKey converts a cursor key to an article ID. Keys that aren't
+// IDs sort before every article.
+func articleKey(key string) int64 {
+	n, _ := strconv.ParseInt(key, 10, 64)
+	return n
+}
+
+// GetArticle returns an article
+func (store *SQLArticleStore) GetArticle(ctx context.Context, id string) (_ *Article, err error) {
+	ctx, done := startQuery(ctx, "articles.get")
+	defer done(&err)
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrArticleNotFound
+	}
+
+	article := new(Article)
+	err = store.DB.QueryRowContext(ctx, `SELECT id, title, version, updated_at FROM dbo.articles WHERE id = ?;`, n).
+		Scan(&article.ID, &article.Title, &article.Version, &article.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrArticleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// CreateArticle inserts an article
+func (store *SQLArticleStore) CreateArticle(ctx context.Context, article *Article) (err error) {
+	ctx, done := startQuery(ctx, "articles.create")
+	defer done(&err)
+
+	return store.DB.QueryRowContext(ctx, `
+	INSERT INTO dbo.articles (title)
+	OUTPUT INSERTED.id, INSERTED.version, INSERTED.updated_at
+	VALUES (?);`, article.Title).Scan(&article.ID, &article.Version, &article.UpdatedAt)
+}
+
+// UpdateArticle saves an article
+func (store *SQLArticleStore) UpdateArticle(ctx context.Context, article *Article) (err error) {
+	ctx, done := startQuery(ctx, "articles.update")
+	defer done(&err)
+
+	n, err := strconv.ParseInt(article.ID, 10, 64)
+	if err != nil {
+		return ErrArticleNotFound
+	}
+
+	// only the expected version is updated, so a concurrent save in
+	// between leaves no row to update
+	var version int64
+	var updated time.Time
+	err = store.DB.QueryRowContext(ctx, `
+	UPDATE dbo.articles
+	SET title = ?, version = version + 1, updated_at = SYSUTCDATETIME()
+	OUTPUT INSERTED.version, INSERTED.updated_at
+	WHERE id = ? AND version = ?;`, article.Title, n, article.Version).Scan(&version, &updated)
+	if err == sql.ErrNoRows {
+		err = store.DB.QueryRowContext(ctx, `SELECT 1 FROM dbo.articles WHERE id = ?;`, n).Scan(new(int))
+		if err == sql.ErrNoRows {
+			return ErrArticleNotFound
+		}
+		if err == nil {
+			err = ErrVersionConflict
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	article.Version, article.UpdatedAt = version, updated
+	return nil
+}
+
+// DeleteArticle removes an article
+func (store *SQLArticleStore) DeleteArticle(ctx context.Context, id string, version int64) (_ *Article, err error) {
+	ctx, done := startQuery(ctx, "articles.delete")
+	defer done(&err)
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrArticleNotFound
+	}
+
+	// like updates, only the expected version is deleted
+	article := new(Article)
+	err = store.DB.QueryRowContext(ctx, `
+	DELETE FROM dbo.articles
+	OUTPUT DELETED.id, DELETED.title, DELETED.version
+	WHERE id = ? AND version = ?;`, n, version).Scan(&article.ID, &article.Title, &article.Version)
+	if err == sql.ErrNoRows {
+		err = store.DB.QueryRowContext(ctx, `SELECT 1 FROM dbo.articles WHERE id = ?;`, n).Scan(new(int))
+		if err == sql.ErrNoRows {
+			return nil, ErrArticleNotFound
+		}
+		if err == nil {
+			err = ErrVersionConflict
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// articleColumns maps sortable fields to their columns.
+var articleColumns = map[string]string{"score": "score", "id": "id", "title": "title"}
+
+// SearchArticles returns the articles matching a query
+func (store *SQLArticleStore) SearchArticles(ctx context.Context, q SearchQuery) (_ []*ScoredArticle, err error) {
+	ctx, done := startQuery(ctx, "articles.search")
+	defer done(&err)
+
+	words := terms(q.Text)
+	limit := q.Limit
+	if limit == 0 {
+		limit = math.MaxInt32
+	}
+
+	var query string
+	args := []interface{}{limit}
+	if store.FullText && len(words) > 0 {
+		// prefix match every word, ranked by SQL Server
+		prefixes := make([]string, len(words))
+		for i, w := range words {
+			prefixes[i] = `"` + w + `*"`
+		}
+		query = `
+		SELECT TOP(?) A.id, A.title, A.version, CAST(K.[RANK] AS FLOAT) / 1000 AS score
+		FROM dbo.articles A
+		INNER JOIN CONTAINSTABLE(dbo.articles, title, ?) K ON K.[KEY] = A.id
+		WHERE 1 = 1`
+		args = append(args, strings.Join(prefixes, " OR "))
+	} else {
+		// score the share of words found in the title
+		score := "0"
+		match := "1 = 1"
+		if len(words) > 0 {
+			cases := make([]string, len(words))
+			likes := make([]string, len(words))
+			for i, w := range words {
+				cases[i] = "CASE WHEN title LIKE ? THEN 1 ELSE 0 END"
+				likes[i] = "title LIKE ?"
+				args = append(args, "%"+escapeLike(w)+"%")
+			}
+			for _, w := range words {
+				args = append(args, "%"+escapeLike(w)+"%")
+			}
+			score = "CAST(" + strings.Join(cases, " + ") + " AS FLOAT) / " + strconv.Itoa(len(words))
+			match = "(" + strings.Join(likes, " OR ") + ")"
+		}
+		query = `
+		SELECT TOP(?) id, title, version, ` + score + ` AS score
+		FROM dbo.articles A
+		WHERE ` + match
+	}
+
+	for _, field := range ArticleSearchFields {
+		if value, ok := q.Filters[field]; ok {
+			query += " AND LOWER(CAST(A." + field + " AS NVARCHAR(255))) = LOWER(?)"
+			args = append(args, value)
+		}
+	}
+
+	sort := q.Sort
+	if len(sort) == 0 {
+		sort = DefaultArticleSort
+	}
+	order := make([]string, len(sort))
+	for i, sf := range sort {
+		order[i] = articleColumns[sf.Field]
+		if sf.Desc {
+			order[i] += " DESC"
+		}
+	}
+	query += " ORDER BY " + strings.Join(order, ", ") + ", A.id;"
+
+	rows, err := store.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*ScoredArticle, 0)
+
+	for rows.Next() {
+		result := &ScoredArticle{Article: new(Article)}
+		err1 := rows.Scan(&result.ID, &result.Title, &result.Version, &result.Score)
+		if err1 != nil {
+			return nil, err1
+		}
+		results = append(results, result)
+	}
+	if err2 := rows.Err(); err2 != nil {
+		return nil, err2
+	}
+	return results, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term.
+func escapeLike(s string) string {
+	return strings.NewReplacer("[", "[[]", "%", "[%]", "_", "[_]").Replace(s)
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryArticleStore is an ArticleStore held in memory. It is safe for
+// concurrent use and hands out copies so callers can't change stored
+// articles behind its back.
+type MemoryArticleStore struct {
+	mu       sync.RWMutex
+	articles map[string]*Article
+	lastID   int64
+}
+
+// NewMemoryArticleStore returns an in-memory store seeded with some
+// fixture data.
+func NewMemoryArticleStore() *MemoryArticleStore {
+	store := &MemoryArticleStore{
+		articles: make(map[string]*Article),
+	}
+	store.CreateArticle(context.Background(), &Article{Title: "Hi"})
+	store.CreateArticle(context.Background(), &Article{Title: "sup"})
+	return store
+}
+
+// ListArticles returns a page of articles
+func (store *MemoryArticleStore) ListArticles(ctx context.Context, q PageQuery) ([]*Article, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	results := make([]*Article, 0, len(store.articles))
+	for _, a := range store.articles {
+		article := *a
+		results = append(results, &article)
+	}
+	sort.Slice(results, func(i, j int) bool { return articleID(results[i]) < articleID(results[j]) })
+	return pageArticles(results, q), nil
+}
+
+// pageArticles applies a page query to articles already ordered by ID.
+func pageArticles(articles []*Article, q PageQuery) []*Article {
+	from, to := 0, len(articles)
+	switch {
+	case q.After != "":
+		after, _ := strconv.ParseInt(q.After, 10, 64)
+		from = sort.Search(len(articles), func(i int) bool { return articleID(articles[i]) > after })
+	case q.Before != "":
+		before, _ := strconv.ParseInt(q.Before, 10, 64)
+		to = sort.Search(len(articles), func(i int) bool { return articleID(articles[i]) >= before })
+		if q.Limit > 0 && to-q.Limit > from {
+			from = to - q.Limit
+		}
+	default:
+		from = q.Offset
+	}
+	if from > len(articles) {
+		from = len(articles)
+	}
+	if q.Limit > 0 && from+q.Limit < to {
+		to = from + q.Limit
+	}
+	return articles[from:to]
+}
+
+// GetArticle returns an article
+func (store *MemoryArticleStore) GetArticle(ctx context.Context, id string) (*Article, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	a, ok := store.articles[id]
+	if !ok {
+		return nil, ErrArticleNotFound
+	}
+	article := *a
+	return &article, nil
+}
+
+// CreateArticle inserts an article
+func (store *MemoryArticleStore) CreateArticle(ctx context.Context, article *Article) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.lastID++
+	article.ID = strconv.FormatInt(store.lastID, 10)
+	article.Version = 1
+	article.UpdatedAt = time.Now().UTC()
+	a := *article
+	store.articles[a.ID] = &a
+	return nil
+}
+
+// UpdateArticle saves an article
+func (store *MemoryArticleStore) UpdateArticle(ctx context.Context, article *Article) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	old, ok := store.articles[article.ID]
+	if !ok {
+		return ErrArticleNotFound
+	}
+	if article.Version != old.Version {
+		return ErrVersionConflict
+	}
+	article.Version++
+	article.UpdatedAt = time.Now().UTC()
+	a := *article
+	store.articles[a.ID] = &a
+	return nil
+}
+
+// DeleteArticle removes an article
+func (store *MemoryArticleStore) DeleteArticle(ctx context.Context, id string, version int64) (*Article, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	a, ok := store.articles[id]
+	if !ok {
+		return nil, ErrArticleNotFound
+	}
+	if a.Version != version {
+		return nil, ErrVersionConflict
+	}
+	delete(store.articles, id)
+	return a, nil
+}
+
+// SearchArticles returns the articles matching a query. Like the SQL
+// store's LIKE search, a title matches the query terms it contains
+// anywhere and scores the share of terms it contains.
+func (store *MemoryArticleStore) SearchArticles(ctx context.Context, q SearchQuery) ([]*ScoredArticle, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	words := terms(q.Text)
+	scores := make(map[string]float64)
+	for id, a := range store.articles {
+		title := strings.ToLower(a.Title)
+		found := 0
+		for _, word := range words {
+			if strings.Contains(title, word) {
+				found++
+			}
+		}
+		if len(words) == 0 {
+			scores[id] = 0
+		} else if found > 0 {
+			scores[id] = float64(found) / float64(len(words))
+		}
+	}
+
+	results := make([]*ScoredArticle, 0, len(scores))
+	for id, score := range scores {
+		article := *store.articles[id]
+		if !matchesFilters(&article, q.Filters) {
+			continue
+		}
+		results = append(results, &ScoredArticle{Article: &article, Score: score})
+	}
+
+	order := q.Sort
+	if len(order) == 0 {
+		order = DefaultArticleSort
+	}
+	sort.Slice(results, func(i, j int) bool { return lessScored(results[i], results[j], order) })
+
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// matchesFilters reports whether an article's fields equal the filters.
+func matchesFilters(a *Article, filters map[string]string) bool {
+	for field, value := range filters {
+		var actual string
+		switch field {
+		case "id":
+			actual = a.ID
+		case "title":
+			actual = a.Title
+		}
+		if !strings.EqualFold(actual, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// lessScored orders two results by the sort fields.
+func lessScored(a, b *ScoredArticle, order []SortField) bool {
+	for _, sf := range order {
+		var cmp int
+		switch sf.Field {
+		case "score":
+			cmp = compareFloat(a.Score, b.Score)
+		case "id":
+			cmp = compareFloat(float64(articleID(a.Article)), float64(articleID(b.Article)))
+		case "title":
+			cmp = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		}
+		if sf.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return articleID(a.Article) < articleID(b.Article)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// articleID returns the numeric ID of an article for ordering.
+func articleID(a *Article) int64 {
+	n, _ := strconv.ParseInt(a.ID, 10, 64)
+	return n
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryArticleStore(t *testing.T) {
+	Convey("Given the seeded in-memory article store", t, func() {
+		store := NewMemoryArticleStore()
+		ctx := context.Background()
+
+		Convey("Concurrent creates get unique IDs", func() {
+			var wg sync.WaitGroup
+			ids := make(chan string, 100)
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					article := &Article{Title: "concurrent"}
+					store.CreateArticle(ctx, article)
+					ids <- article.ID
+				}()
+			}
+			wg.Wait()
+			close(ids)
+
+			seen := make(map[string]bool)
+			for id := range ids {
+				So(seen[id], ShouldBeFalse)
+				seen[id] = true
+			}
+			articles, _ := store.ListArticles(ctx, PageQuery{})
+			So(len(articles), ShouldEqual, 102)
+		})
+
+		Convey("Updates are persisted", func() {
+			article, err := store.GetArticle(ctx, "1")
+			So(err, ShouldBeNil)
+			article.Title = "Hello"
+			So(store.UpdateArticle(ctx, article), ShouldBeNil)
+
+			article, _ = store.GetArticle(ctx, "1")
+			So(article.Title, ShouldEqual, "Hello")
+			So(article.Version, ShouldEqual, 2)
+		})
+
+		Convey("Saving a stale version is a conflict", func() {
+			first, _ := store.GetArticle(ctx, "1")
+			second, _ := store.GetArticle(ctx, "1")
+			first.Title = "first"
+			So(store.UpdateArticle(ctx, first), ShouldBeNil)
+			second.Title = "second"
+			So(store.UpdateArticle(ctx, second), ShouldEqual, ErrVersionConflict)
+
+			article, _ := store.GetArticle(ctx, "1")
+			So(article.Title, ShouldEqual, "first")
+		})
+
+		Convey("Deleting a stale version is a conflict", func() {
+			article, _ := store.GetArticle(ctx, "2")
+			So(store.UpdateArticle(ctx, article), ShouldBeNil)
+			_, err := store.DeleteArticle(ctx, "2", 1)
+			So(err, ShouldEqual, ErrVersionConflict)
+			_, err = store.GetArticle(ctx, "2")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Deleted articles are gone and their IDs aren't reused", func() {
+			_, err := store.DeleteArticle(ctx, "2", 1)
+			So(err, ShouldBeNil)
+			_, err = store.GetArticle(ctx, "2")
+			So(err, ShouldEqual, ErrArticleNotFound)
+			So(store.UpdateArticle(ctx, &Article{ID: "2", Title: "back"}), ShouldEqual, ErrArticleNotFound)
+
+			article := &Article{Title: "new"}
+			store.CreateArticle(ctx, article)
+			So(article.ID, ShouldEqual, "3")
+		})
+
+		Convey("Search filters by field and follows updates", func() {
+			results, _ := store.SearchArticles(ctx, SearchQuery{Filters: map[string]string{"title": "SUP"}})
+			So(len(results), ShouldEqual, 1)
+			So(results[0].ID, ShouldEqual, "2")
+
+			store.UpdateArticle(ctx, &Article{ID: "2", Title: "what's new", Version: 1})
+			results, _ = store.SearchArticles(ctx, SearchQuery{Text: "sup"})
+			So(len(results), ShouldEqual, 0)
+			results, _ = store.SearchArticles(ctx, SearchQuery{Text: "new"})
+			So(len(results), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ArticleSearchFields are the fields articles can be filtered and
+// sorted by. Results can also be sorted by "score".
+var ArticleSearchFields = []string{"id", "title"}
+
+// SortField orders search results by a field.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultArticleSort orders the best matches first.
+var DefaultArticleSort = []SortField{{Field: "score", Desc: true}, {Field: "id"}}
+
+// ParseSort parses a sort param such as "-score,title" where a leading
+// "-" sorts in descending order.
+func ParseSort(s string) ([]SortField, error) {
+	var fields []SortField
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		sf := SortField{Field: strings.TrimPrefix(f, "-"), Desc: strings.HasPrefix(f, "-")}
+		if sf.Field != "score" && !isArticleField(sf.Field) {
+			return nil, errors.Errorf("can't sort by %q", sf.Field)
+		}
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+func isArticleField(field string) bool {
+	for _, f := range ArticleSearchFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchQuery is an article search.
+type SearchQuery struct {
+	Text    string            // words to match in titles, case-insensitively
+	Filters map[string]string // field -> value the field must equal, case-insensitively
+	Sort    []SortField       // defaults to DefaultArticleSort
+	Limit   int               // maximum number of results, 0 for all of them
+}
+
+// ScoredArticle is a search result. Higher scores are better matches.
+type ScoredArticle struct {
+	*Article
+	Score float64 `json:"score"`
+}
+
+// ArticleSearcher searches articles.
+type ArticleSearcher interface {
+	// SearchArticles returns the articles matching a query.
+	SearchArticles(ctx context.Context, q SearchQuery) ([]*ScoredArticle, error)
+}
+
+// terms splits text into lower case search terms.
+func terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryArticleSearch(t *testing.T) {
+	Convey("Given the in-memory article store", t, func() {
+		testArticleSearch(NewMemoryArticleStore())
+	})
+}
+
+// TestSQLArticleSearch runs against the database in TEST_MSSQL_DSN,
+// which needs a dbo.articles table.
+func TestSQLArticleSearch(t *testing.T) {
+	dsn := os.Getenv("TEST_MSSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MSSQL_DSN isn't set")
+	}
+	db, err := sql.Open("mssql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	Convey("Given the SQL article store", t, func() {
+		testArticleSearch(NewSQLArticleStore(db))
+	})
+}
+
+// testArticleSearch checks that a store searches the way every
+// ArticleStore should. It only looks at the articles it creates, so
+// it can run against a database that has others.
+func testArticleSearch(store ArticleStore) {
+	ctx := context.Background()
+	marker := "m" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	var created []*Article
+	for _, title := range []string{"Hello world", "Othello", "Hi there, WORLD"} {
+		article := &Article{Title: title + " " + marker}
+		So(store.CreateArticle(ctx, article), ShouldBeNil)
+		created = append(created, article)
+	}
+	Reset(func() {
+		for _, article := range created {
+			store.DeleteArticle(ctx, article.ID, article.Version)
+		}
+	})
+
+	// search returns the results for the articles created above
+	search := func(q SearchQuery) []*ScoredArticle {
+		results, err := store.SearchArticles(ctx, q)
+		So(err, ShouldBeNil)
+		var mine []*ScoredArticle
+		for _, result := range results {
+			for _, article := range created {
+				if result.ID == article.ID {
+					mine = append(mine, result)
+				}
+			}
+		}
+		return mine
+	}
+
+	Convey("Search matches terms anywhere in a title, case-insensitively", func() {
+		results := search(SearchQuery{Text: "HELLO"})
+		So(len(results), ShouldEqual, 2)
+		So(results[0].ID, ShouldEqual, created[0].ID)
+		So(results[0].Score, ShouldEqual, 1)
+		So(results[1].ID, ShouldEqual, created[1].ID)
+		So(results[1].Score, ShouldEqual, 1)
+	})
+
+	Convey("Search scores the share of terms found", func() {
+		results := search(SearchQuery{Text: "hello world"})
+		So(len(results), ShouldEqual, 3)
+		So(results[0].ID, ShouldEqual, created[0].ID)
+		So(results[0].Score, ShouldEqual, 1)
+		So(results[1].ID, ShouldEqual, created[1].ID)
+		So(results[1].Score, ShouldEqual, 0.5)
+		So(results[2].ID, ShouldEqual, created[2].ID)
+		So(results[2].Score, ShouldEqual, 0.5)
+	})
+
+	Convey("Search sorts by the given fields", func() {
+		results := search(SearchQuery{Text: "world", Sort: []SortField{{Field: "title", Desc: true}}})
+		So(len(results), ShouldEqual, 2)
+		So(results[0].ID, ShouldEqual, created[2].ID)
+		So(results[1].ID, ShouldEqual, created[0].ID)
+	})
+
+	Convey("Search without terms filters every article", func() {
+		results := search(SearchQuery{Filters: map[string]string{"title": "OTHELLO " + marker}})
+		So(len(results), ShouldEqual, 1)
+		So(results[0].ID, ShouldEqual, created[1].ID)
+		So(results[0].Score, ShouldEqual, 0)
+	})
+}
+
+func TestEscapeLike(t *testing.T) {
+	Convey("escapeLike makes LIKE wildcards match themselves", t, func() {
+		So(escapeLike("H&R Block"), ShouldEqual, "H&R Block")
+		So(escapeLike("100%"), ShouldEqual, "100[%]")
+		So(escapeLike("tax_pro"), ShouldEqual, "tax[_]pro")
+		So(escapeLike("[a-z]"), ShouldEqual, "[[]a-z]")
+	})
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Errors returned in place of a driver's error when a query's context
+// ended before it finished.
+var (
+	// ErrQueryTimeout means the query ran past its deadline.
+	ErrQueryTimeout = errors.New("query timed out")
+
+	// ErrQueryCanceled means the caller gave up on the query, e.g. the
+	// client went away.
+	ErrQueryCanceled = errors.New("query canceled")
+)
+
+// QueryTimeout bounds every SQL query. Zero leaves queries bounded only
+// by their caller's context.
+var QueryTimeout time.Duration
+
+// QueryObserver, when set, is told how long each SQL query took and
+// whether it failed. Lookups that find nothing and version conflicts
+// are not failures.
+var QueryObserver func(query string, elapsed time.Duration, failed bool)
+
+// startQuery derives the context a query runs under. The returned func
+// is deferred with a pointer to the method's error result: it replaces
+// the error with ErrQueryTimeout or ErrQueryCanceled when the context
+// ended, reports the query to QueryObserver and releases the context.
+func startQuery(ctx context.Context, query string) (context.Context, func(*error)) {
+	start := time.Now()
+	cancel := func() {}
+	if QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, QueryTimeout)
+	}
+	return ctx, func(err *error) {
+		defer cancel()
+		failed := *err != nil && *err != sql.ErrNoRows && *err != ErrNotFound && *err != ErrArticleNotFound && *err != ErrVersionConflict
+		if failed {
+			switch ctx.Err() {
+			case context.DeadlineExceeded:
+				*err = ErrQueryTimeout
+			case context.Canceled:
+				*err = ErrQueryCanceled
+			}
+		}
+		if QueryObserver != nil {
+			QueryObserver(query, time.Since(start), failed)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStartQuery(t *testing.T) {
+	Convey("Given a query timeout", t, func() {
+		QueryTimeout = time.Millisecond
+		defer func() { QueryTimeout = 0 }()
+
+		run := func(ctx context.Context, fail error) (err error) {
+			ctx, done := startQuery(ctx, "test")
+			defer done(&err)
+			<-ctx.Done()
+			return fail
+		}
+
+		Convey("A query past its deadline times out", func() {
+			So(run(context.Background(), errors.New("driver: deadline")), ShouldEqual, ErrQueryTimeout)
+		})
+
+		Convey("A query whose caller gave up is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(run(ctx, errors.New("driver: canceled")), ShouldEqual, ErrQueryCanceled)
+		})
+
+		Convey("Not finding anything is left alone", func() {
+			So(run(context.Background(), ErrNotFound), ShouldEqual, ErrNotFound)
+		})
+	})
+}
@@ -0,0 +1,10 @@
+package models
+
+// PageQuery selects a page of a listing, either by offset or relative
+// to the key of an item from a previous page.
+type PageQuery struct {
+	Limit  int    // maximum number of items, 0 for all of them
+	Offset int    // number of items to skip, in offset mode
+	After  string // only items after this key, in cursor mode
+	Before string // only items before this key, in cursor mode
+}
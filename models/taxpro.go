@@ -1,45 +1,230 @@
 package models
 
 import (
-	"github.com/dstroot/chi_api/database"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
+// ErrNotFound is returned when a tax professional does not exist.
+var ErrNotFound = errors.New("tax professional not found")
+
 // TaxPro is a Tax Professional
 type TaxPro struct {
 	EFIN           string `json:"efin"`
 	CompanyName    string `json:"company_name"`
 	ProductCount   int    `json:"product_count"`
 	PremierPartner bool   `json:"premier_partner"`
+	Tier           string `json:"tier"`
+	TierRule       string `json:"tier_rule"`
+}
+
+// TaxProYear is a tax professional's record for a single system year.
+type TaxProYear struct {
+	Year           string `json:"year"`
+	EFIN           string `json:"efin"`
+	CompanyName    string `json:"company_name"`
+	ProductCount   int    `json:"product_count"`
+	Status         string `json:"status"`
+	PremierPartner bool   `json:"premier_partner"`
+	Tier           string `json:"tier"`
+	TierRule       string `json:"tier_rule"`
 }
 
+// TaxProRepository is the storage used to look up tax professionals. It lets
+// the handlers run against SQL Server in production and an in-memory store
+// in tests and local development. Repositories return raw product counts,
+// tiers are assigned by a TieredTaxProRepository.
+type TaxProRepository interface {
+	// GetTaxpro returns the tax professional with the given EFIN
+	// for a system year, or ErrNotFound.
+	GetTaxpro(ctx context.Context, year string, efin string) (*TaxPro, error)
+
+	// ListTaxpros returns every tax professional for a system year.
+	ListTaxpros(ctx context.Context, year string) ([]*TaxPro, error)
+
+	// SearchTaxpros returns the tax professionals for a system year
+	// whose company name contains the query.
+	SearchTaxpros(ctx context.Context, year string, query string) ([]*TaxPro, error)
+
+	// LookupTaxpros returns the tax professionals for a system year
+	// matching any of the given EFINs. EFINs that don't exist are
+	// simply missing from the results.
+	LookupTaxpros(ctx context.Context, year string, efins []string) ([]*TaxPro, error)
+
+	// TaxproHistory returns the tax professional's record for every
+	// system year it appears in, oldest first.
+	TaxproHistory(ctx context.Context, efin string) ([]*TaxProYear, error)
+}
+
+// SQLTaxProRepository is a TaxProRepository backed by SQL Server.
+type SQLTaxProRepository struct {
+	DB *sql.DB
+}
+
+// NewSQLTaxProRepository returns a repository that queries the given database.
+func NewSQLTaxProRepository(db *sql.DB) *SQLTaxProRepository {
+	return &SQLTaxProRepository{DB: db}
+}
+
+// selectTaxpros is the common projection for all tax professional queries.
+const selectTaxpros = `
+	SELECT %s
+		E.EFIN,
+		E.CompanyName,
+		D.PriorVolume
+	FROM  eroyeardetail D
+	RIGHT OUTER JOIN ero E on E.id = D.ero_id
+	WHERE D.systemyear = ?
+		AND D.status IN ('A', 'C', 'D')
+		AND LastImportDate <> ''`
+
 // GetTaxpro returns a tax professional
-func GetTaxpro(year string, efin string) ([]*TaxPro, error) {
+func (repo *SQLTaxProRepository) GetTaxpro(ctx context.Context, year string, efin string) (_ *TaxPro, err error) {
+	ctx, done := startQuery(ctx, "taxpro.get")
+	defer done(&err)
+
+	query := fmt.Sprintf(selectTaxpros, "TOP(1)") + `
+		AND E.EFIN = ?;`
+
+	results, err := repo.query(ctx, query, year, efin)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return results[0], nil
+}
+
+// ListTaxpros returns all tax professionals for a year
+func (repo *SQLTaxProRepository) ListTaxpros(ctx context.Context, year string) (_ []*TaxPro, err error) {
+	ctx, done := startQuery(ctx, "taxpro.list")
+	defer done(&err)
+
+	query := fmt.Sprintf(selectTaxpros, "") + `
+	ORDER BY E.EFIN;`
+
+	return repo.query(ctx, query, year)
+}
+
+// SearchTaxpros returns tax professionals whose company name contains
+// q. LIKE wildcards in q match themselves.
+func (repo *SQLTaxProRepository) SearchTaxpros(ctx context.Context, year string, q string) (_ []*TaxPro, err error) {
+	ctx, done := startQuery(ctx, "taxpro.search")
+	defer done(&err)
+
+	query := fmt.Sprintf(selectTaxpros, "") + `
+		AND E.CompanyName LIKE ?
+	ORDER BY E.EFIN;`
+
+	return repo.query(ctx, query, year, "%"+escapeLike(q)+"%")
+}
+
+// LookupTaxpros returns the tax professionals matching a batch of EFINs
+// using a single query. SQL Server allows at most 2100 parameters per
+// statement, so callers should keep batches well below that.
+func (repo *SQLTaxProRepository) LookupTaxpros(ctx context.Context, year string, efins []string) (_ []*TaxPro, err error) {
+	ctx, done := startQuery(ctx, "taxpro.lookup")
+	defer done(&err)
+
+	if len(efins) == 0 {
+		return make([]*TaxPro, 0), nil
+	}
+
+	args := make([]interface{}, 0, len(efins)+1)
+	args = append(args, year)
+	for _, efin := range efins {
+		args = append(args, efin)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(efins)), ", ")
+
+	query := fmt.Sprintf(selectTaxpros, "") + `
+		AND E.EFIN IN (` + placeholders + `)
+	ORDER BY E.EFIN;`
+
+	results, err := repo.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// An EFIN can have more than one matching row, keep the first one
+	// like GetTaxpro does.
+	unique := results[:0]
+	seen := make(map[string]bool, len(results))
+	for _, pro := range results {
+		if !seen[pro.EFIN] {
+			seen[pro.EFIN] = true
+			unique = append(unique, pro)
+		}
+	}
+	return unique, nil
+}
+
+// TaxproHistory returns a tax professional's record for every system
+// year, filtered like the single year queries.
+func (repo *SQLTaxProRepository) TaxproHistory(ctx context.Context, efin string) (_ []*TaxProYear, err error) {
+	ctx, done := startQuery(ctx, "taxpro.history")
+	defer done(&err)
 
 	query := `
-	SELECT TOP(1)
+	SELECT
+		D.systemyear,
 		E.EFIN,
 		E.CompanyName,
 		D.PriorVolume,
-		PremierPartner = CASE WHEN D.PriorVolume < 250 THEN 0 ELSE 1 END
+		D.status
 	FROM  eroyeardetail D
-	RIGHT OUTER JOIN ero E on E.id = D.ero_id
-	WHERE D.systemyear = ?
+	INNER JOIN ero E on E.id = D.ero_id
+	WHERE E.EFIN = ?
 		AND D.status IN ('A', 'C', 'D')
-		AND LastImportDate <> '' AND E.EFIN = ?;`
+		AND LastImportDate <> ''
+	ORDER BY D.systemyear, D.LastImportDate DESC, E.id;`
+
+	rows, err := repo.DB.QueryContext(ctx, query, efin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*TaxProYear, 0)
+
+	for rows.Next() {
+		pro := new(TaxProYear)
+		err1 := rows.Scan(&pro.Year, &pro.EFIN, &pro.CompanyName, &pro.ProductCount, &pro.Status)
+		if err1 != nil {
+			return nil, err1
+		}
+		// keep the most recently imported row for each year
+		if n := len(results); n > 0 && results[n-1].Year == pro.Year {
+			continue
+		}
+		results = append(results, pro)
+	}
+	if err2 := rows.Err(); err2 != nil {
+		return nil, err2
+	}
+	return results, nil
+}
 
-	rows, err := database.DB.Query(query, year, efin)
+// query runs a tax professional query and scans the results.
+func (repo *SQLTaxProRepository) query(ctx context.Context, query string, args ...interface{}) ([]*TaxPro, error) {
+	rows, err := repo.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	results := make([]*TaxPro, 0)
-	pro := new(TaxPro)
 
 	for rows.Next() {
-		err1 := rows.Scan(&pro.EFIN, &pro.CompanyName, &pro.ProductCount, &pro.PremierPartner)
+		pro := new(TaxPro)
+		err1 := rows.Scan(&pro.EFIN, &pro.CompanyName, &pro.ProductCount)
 		if err1 != nil {
-			return nil, err
+			return nil, err1
 		}
 		results = append(results, pro)
 	}
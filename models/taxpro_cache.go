@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedTaxProRepository wraps a TaxProRepository and caches single
+// tax professional lookups. Data for closed system years rarely
+// changes, so it's kept much longer than the current year's. EFINs that
+// don't exist are cached too, for NotFoundTTL. Other calls go straight
+// to the wrapped repository.
+type CachedTaxProRepository struct {
+	TaxProRepository
+
+	PastTTL     time.Duration // for years before CurrentYear
+	CurrentTTL  time.Duration // for CurrentYear and later
+	NotFoundTTL time.Duration // for EFINs that don't exist
+	CurrentYear int           // 0 for this calendar year
+	MaxEntries  int           // 0 for no limit
+
+	hits, misses uint64
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	now     func() time.Time
+}
+
+type cacheKey struct {
+	year, efin string
+}
+
+// cacheEntry is a cached tax professional, or nil for one that
+// doesn't exist.
+type cacheEntry struct {
+	pro     *TaxPro
+	expires time.Time
+}
+
+// NewCachedTaxProRepository returns repo with lookups cached for ttl,
+// or currentTTL in the current system year.
+func NewCachedTaxProRepository(repo TaxProRepository, ttl, currentTTL, notFoundTTL time.Duration) *CachedTaxProRepository {
+	return &CachedTaxProRepository{
+		TaxProRepository: repo,
+		PastTTL:          ttl,
+		CurrentTTL:       currentTTL,
+		NotFoundTTL:      notFoundTTL,
+		entries:          make(map[cacheKey]*cacheEntry),
+		now:              time.Now,
+	}
+}
+
+// GetTaxpro returns a tax professional, from the cache when we can.
+func (repo *CachedTaxProRepository) GetTaxpro(ctx context.Context, year string, efin string) (*TaxPro, error) {
+	key := cacheKey{year, efin}
+
+	repo.mu.Lock()
+	e, ok := repo.entries[key]
+	if ok && !repo.now().Before(e.expires) {
+		delete(repo.entries, key)
+		ok = false
+	}
+	repo.mu.Unlock()
+
+	if ok {
+		atomic.AddUint64(&repo.hits, 1)
+		if e.pro == nil {
+			return nil, ErrNotFound
+		}
+		pro := *e.pro
+		return &pro, nil
+	}
+	atomic.AddUint64(&repo.misses, 1)
+
+	pro, err := repo.TaxProRepository.GetTaxpro(ctx, year, efin)
+	switch {
+	case err == ErrNotFound:
+		repo.store(key, nil, repo.NotFoundTTL)
+	case err == nil:
+		cached := *pro
+		repo.store(key, &cached, repo.ttl(year))
+	}
+	return pro, err
+}
+
+// ttl returns how long a tax professional of a system year is cached.
+func (repo *CachedTaxProRepository) ttl(year string) time.Duration {
+	current := repo.CurrentYear
+	if current == 0 {
+		current = repo.now().Year()
+	}
+	if y, err := strconv.Atoi(year); err == nil && y < current {
+		return repo.PastTTL
+	}
+	return repo.CurrentTTL
+}
+
+// store caches a lookup. Once the cache is full, expired entries are
+// dropped to make room, and failing that an arbitrary one.
+func (repo *CachedTaxProRepository) store(key cacheKey, pro *TaxPro, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	now := repo.now()
+	if repo.MaxEntries > 0 && len(repo.entries) >= repo.MaxEntries {
+		for k, e := range repo.entries {
+			if !now.Before(e.expires) {
+				delete(repo.entries, k)
+			}
+		}
+		for k := range repo.entries {
+			if len(repo.entries) < repo.MaxEntries {
+				break
+			}
+			delete(repo.entries, k)
+		}
+	}
+	repo.entries[key] = &cacheEntry{pro: pro, expires: now.Add(ttl)}
+}
+
+// Purge drops the cached lookups of an EFIN, of a system year, or both
+// when both are given. With neither it empties the cache. It returns
+// how many entries were dropped.
+func (repo *CachedTaxProRepository) Purge(year, efin string) int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	n := 0
+	for k := range repo.entries {
+		if (year == "" || k.year == year) && (efin == "" || k.efin == efin) {
+			delete(repo.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// Hits returns the number of lookups answered from the cache.
+func (repo *CachedTaxProRepository) Hits() uint64 {
+	return atomic.LoadUint64(&repo.hits)
+}
+
+// Misses returns the number of lookups passed to the wrapped
+// repository.
+func (repo *CachedTaxProRepository) Misses() uint64 {
+	return atomic.LoadUint64(&repo.misses)
+}
+
+// Len returns the number of cached entries, expired ones included.
+func (repo *CachedTaxProRepository) Len() int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return len(repo.entries)
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingTaxPros counts the lookups that reach the repository.
+type countingTaxPros struct {
+	TaxProRepository
+	calls int
+}
+
+func (c *countingTaxPros) GetTaxpro(ctx context.Context, year string, efin string) (*TaxPro, error) {
+	c.calls++
+	return c.TaxProRepository.GetTaxpro(ctx, year, efin)
+}
+
+func TestCachedTaxProRepository(t *testing.T) {
+	Convey("Given a cache in front of the seeded repository", t, func() {
+		ctx := context.Background()
+		backend := &countingTaxPros{TaxProRepository: NewMemoryTaxProRepository()}
+		cache := NewCachedTaxProRepository(backend, time.Hour, time.Minute, 10*time.Second)
+		cache.CurrentYear = 2017
+		now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache.now = func() time.Time { return now }
+
+		Convey("Repeat lookups are served from the cache", func() {
+			cache.GetTaxpro(ctx, "2016", "012345")
+			pro, err := cache.GetTaxpro(ctx, "2016", "012345")
+			So(err, ShouldBeNil)
+			So(pro.CompanyName, ShouldEqual, "Acme Tax Service")
+			So(backend.calls, ShouldEqual, 1)
+			So(cache.Hits(), ShouldEqual, 1)
+			So(cache.Misses(), ShouldEqual, 1)
+
+			Convey("and callers can't change the cached copy", func() {
+				pro.Tier = "Gold"
+				pro, _ = cache.GetTaxpro(ctx, "2016", "012345")
+				So(pro.Tier, ShouldEqual, "")
+			})
+		})
+
+		Convey("The current year expires sooner than past years", func() {
+			cache.GetTaxpro(ctx, "2016", "012345")
+			cache.GetTaxpro(ctx, "2017", "012345")
+			now = now.Add(2 * time.Minute)
+			cache.GetTaxpro(ctx, "2016", "012345")
+			cache.GetTaxpro(ctx, "2017", "012345")
+			So(backend.calls, ShouldEqual, 3)
+		})
+
+		Convey("Unknown EFINs are cached as not found", func() {
+			_, err := cache.GetTaxpro(ctx, "2016", "999999")
+			So(err, ShouldEqual, ErrNotFound)
+			_, err = cache.GetTaxpro(ctx, "2016", "999999")
+			So(err, ShouldEqual, ErrNotFound)
+			So(backend.calls, ShouldEqual, 1)
+
+			now = now.Add(10 * time.Second)
+			cache.GetTaxpro(ctx, "2016", "999999")
+			So(backend.calls, ShouldEqual, 2)
+		})
+
+		Convey("Entries can be purged by EFIN or year", func() {
+			cache.GetTaxpro(ctx, "2016", "012345")
+			cache.GetTaxpro(ctx, "2017", "012345")
+			cache.GetTaxpro(ctx, "2017", "123456")
+			So(cache.Purge("", "012345"), ShouldEqual, 2)
+			So(cache.Purge("2017", ""), ShouldEqual, 1)
+			So(cache.Len(), ShouldEqual, 0)
+		})
+
+		Convey("A full cache makes room", func() {
+			cache.MaxEntries = 2
+			cache.GetTaxpro(ctx, "2017", "012345")
+			cache.GetTaxpro(ctx, "2017", "123456")
+			cache.GetTaxpro(ctx, "2017", "654321")
+			So(cache.Len(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryTaxProRepository is a TaxProRepository held in memory. It is
+// safe for concurrent use and is meant for tests and local development.
+type MemoryTaxProRepository struct {
+	mu    sync.RWMutex
+	years map[string]map[string]*TaxPro // year -> efin -> pro
+}
+
+// NewMemoryTaxProRepository returns an in-memory repository seeded
+// with some fixture data.
+func NewMemoryTaxProRepository() *MemoryTaxProRepository {
+	repo := &MemoryTaxProRepository{years: make(map[string]map[string]*TaxPro)}
+	repo.Add("2016", &TaxPro{EFIN: "012345", CompanyName: "Acme Tax Service", ProductCount: 310})
+	repo.Add("2016", &TaxPro{EFIN: "123456", CompanyName: "Main Street Taxes", ProductCount: 75})
+	repo.Add("2017", &TaxPro{EFIN: "012345", CompanyName: "Acme Tax Service", ProductCount: 402})
+	repo.Add("2017", &TaxPro{EFIN: "123456", CompanyName: "Main Street Taxes", ProductCount: 260})
+	repo.Add("2017", &TaxPro{EFIN: "654321", CompanyName: "Riverside Bookkeeping", ProductCount: 12})
+	return repo
+}
+
+// Add stores a tax professional for a system year, replacing any
+// existing record with the same EFIN.
+func (repo *MemoryTaxProRepository) Add(year string, pro *TaxPro) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if repo.years[year] == nil {
+		repo.years[year] = make(map[string]*TaxPro)
+	}
+	repo.years[year][pro.EFIN] = pro
+}
+
+// GetTaxpro returns a tax professional
+func (repo *MemoryTaxProRepository) GetTaxpro(ctx context.Context, year string, efin string) (*TaxPro, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	pro, ok := repo.years[year][efin]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p := *pro
+	return &p, nil
+}
+
+// ListTaxpros returns all tax professionals for a year
+func (repo *MemoryTaxProRepository) ListTaxpros(ctx context.Context, year string) ([]*TaxPro, error) {
+	return repo.filter(year, func(*TaxPro) bool { return true }), nil
+}
+
+// SearchTaxpros returns tax professionals whose company name matches
+func (repo *MemoryTaxProRepository) SearchTaxpros(ctx context.Context, year string, q string) ([]*TaxPro, error) {
+	q = strings.ToLower(q)
+	return repo.filter(year, func(pro *TaxPro) bool {
+		return strings.Contains(strings.ToLower(pro.CompanyName), q)
+	}), nil
+}
+
+// LookupTaxpros returns the tax professionals matching a batch of EFINs
+func (repo *MemoryTaxProRepository) LookupTaxpros(ctx context.Context, year string, efins []string) ([]*TaxPro, error) {
+	wanted := make(map[string]bool, len(efins))
+	for _, efin := range efins {
+		wanted[efin] = true
+	}
+	return repo.filter(year, func(pro *TaxPro) bool {
+		return wanted[pro.EFIN]
+	}), nil
+}
+
+// TaxproHistory returns a tax professional's record for every system year.
+// The in-memory store only holds active records, so every year is
+// reported with status "A".
+func (repo *MemoryTaxProRepository) TaxproHistory(ctx context.Context, efin string) ([]*TaxProYear, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	results := make([]*TaxProYear, 0)
+	for year, pros := range repo.years {
+		if pro, ok := pros[efin]; ok {
+			results = append(results, &TaxProYear{
+				Year:         year,
+				EFIN:         pro.EFIN,
+				CompanyName:  pro.CompanyName,
+				ProductCount: pro.ProductCount,
+				Status:       "A",
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Year < results[j].Year })
+	return results, nil
+}
+
+// filter returns copies of the tax professionals for a year that
+// match, ordered by EFIN like the SQL listing.
+func (repo *MemoryTaxProRepository) filter(year string, match func(*TaxPro) bool) []*TaxPro {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	results := make([]*TaxPro, 0)
+	for _, pro := range repo.years[year] {
+		if match(pro) {
+			p := *pro
+			results = append(results, &p)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].EFIN < results[j].EFIN })
+	return results
+}
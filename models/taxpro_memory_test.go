@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryTaxProRepository(t *testing.T) {
+	Convey("Given the seeded in-memory tax professional repository", t, func() {
+		var repo TaxProRepository = NewMemoryTaxProRepository()
+		ctx := context.Background()
+
+		efins := func(pros []*TaxPro) []string {
+			list := make([]string, len(pros))
+			for i, pro := range pros {
+				list[i] = pro.EFIN
+			}
+			return list
+		}
+
+		Convey("A tax professional can be read by year and EFIN", func() {
+			pro, err := repo.GetTaxpro(ctx, "2017", "012345")
+			So(err, ShouldBeNil)
+			So(pro.CompanyName, ShouldEqual, "Acme Tax Service")
+			So(pro.ProductCount, ShouldEqual, 402)
+
+			Convey("as a copy the caller can change", func() {
+				pro.ProductCount = 0
+				again, _ := repo.GetTaxpro(ctx, "2017", "012345")
+				So(again.ProductCount, ShouldEqual, 402)
+			})
+		})
+
+		Convey("Unknown EFINs and years are not found", func() {
+			_, err := repo.GetTaxpro(ctx, "2017", "999999")
+			So(err, ShouldEqual, ErrNotFound)
+			_, err = repo.GetTaxpro(ctx, "2015", "012345")
+			So(err, ShouldEqual, ErrNotFound)
+		})
+
+		Convey("A year lists its tax professionals ordered by EFIN", func() {
+			pros, err := repo.ListTaxpros(ctx, "2017")
+			So(err, ShouldBeNil)
+			So(efins(pros), ShouldResemble, []string{"012345", "123456", "654321"})
+
+			pros, err = repo.ListTaxpros(ctx, "2015")
+			So(err, ShouldBeNil)
+			So(pros, ShouldBeEmpty)
+		})
+
+		Convey("Search matches company names ignoring case", func() {
+			pros, err := repo.SearchTaxpros(ctx, "2017", "TAX")
+			So(err, ShouldBeNil)
+			So(efins(pros), ShouldResemble, []string{"012345", "123456"})
+
+			pros, err = repo.SearchTaxpros(ctx, "2017", "nobody")
+			So(err, ShouldBeNil)
+			So(pros, ShouldBeEmpty)
+		})
+
+		Convey("A lookup leaves out the EFINs it doesn't find", func() {
+			pros, err := repo.LookupTaxpros(ctx, "2016", []string{"123456", "654321", "012345"})
+			So(err, ShouldBeNil)
+			So(efins(pros), ShouldResemble, []string{"012345", "123456"})
+		})
+
+		Convey("History covers every year, oldest first", func() {
+			history, err := repo.TaxproHistory(ctx, "012345")
+			So(err, ShouldBeNil)
+			So(len(history), ShouldEqual, 2)
+			So(history[0].Year, ShouldEqual, "2016")
+			So(history[1].Year, ShouldEqual, "2017")
+			So(history[1].Status, ShouldEqual, "A")
+
+			history, err = repo.TaxproHistory(ctx, "999999")
+			So(err, ShouldBeNil)
+			So(history, ShouldBeEmpty)
+		})
+	})
+}
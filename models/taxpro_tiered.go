@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+
+	"github.com/dstroot/chi_api/tiering"
+)
+
+// TieredTaxProRepository wraps a TaxProRepository and assigns each tax
+// professional a partner tier from their product count.
+type TieredTaxProRepository struct {
+	TaxProRepository
+	Tiers *tiering.Engine
+}
+
+// NewTieredTaxProRepository returns repo with tiers evaluated by engine.
+func NewTieredTaxProRepository(repo TaxProRepository, engine *tiering.Engine) *TieredTaxProRepository {
+	return &TieredTaxProRepository{TaxProRepository: repo, Tiers: engine}
+}
+
+// GetTaxpro returns a tax professional
+func (repo *TieredTaxProRepository) GetTaxpro(ctx context.Context, year string, efin string) (*TaxPro, error) {
+	pro, err := repo.TaxProRepository.GetTaxpro(ctx, year, efin)
+	if err != nil {
+		return nil, err
+	}
+	repo.assign(year, pro)
+	return pro, nil
+}
+
+// ListTaxpros returns all tax professionals for a year
+func (repo *TieredTaxProRepository) ListTaxpros(ctx context.Context, year string) ([]*TaxPro, error) {
+	return repo.tier(year)(repo.TaxProRepository.ListTaxpros(ctx, year))
+}
+
+// SearchTaxpros returns tax professionals whose company name matches
+func (repo *TieredTaxProRepository) SearchTaxpros(ctx context.Context, year string, q string) ([]*TaxPro, error) {
+	return repo.tier(year)(repo.TaxProRepository.SearchTaxpros(ctx, year, q))
+}
+
+// LookupTaxpros returns the tax professionals matching a batch of EFINs
+func (repo *TieredTaxProRepository) LookupTaxpros(ctx context.Context, year string, efins []string) ([]*TaxPro, error) {
+	return repo.tier(year)(repo.TaxProRepository.LookupTaxpros(ctx, year, efins))
+}
+
+// TaxproHistory returns a tax professional's record for every system year
+func (repo *TieredTaxProRepository) TaxproHistory(ctx context.Context, efin string) ([]*TaxProYear, error) {
+	results, err := repo.TaxProRepository.TaxproHistory(ctx, efin)
+	if err != nil {
+		return nil, err
+	}
+	for _, pro := range results {
+		m := repo.Tiers.Evaluate(pro.Year, pro.ProductCount)
+		pro.Tier, pro.TierRule, pro.PremierPartner = m.Tier, m.Rule, m.Premier
+	}
+	return results, nil
+}
+
+// tier returns a func that assigns tiers to the results of a
+// repository call for a system year.
+func (repo *TieredTaxProRepository) tier(year string) func([]*TaxPro, error) ([]*TaxPro, error) {
+	return func(results []*TaxPro, err error) ([]*TaxPro, error) {
+		if err != nil {
+			return nil, err
+		}
+		for _, pro := range results {
+			repo.assign(year, pro)
+		}
+		return results, nil
+	}
+}
+
+// assign sets the tier of a tax professional for a system year.
+func (repo *TieredTaxProRepository) assign(year string, pro *TaxPro) {
+	m := repo.Tiers.Evaluate(year, pro.ProductCount)
+	pro.Tier, pro.TierRule, pro.PremierPartner = m.Tier, m.Rule, m.Premier
+}
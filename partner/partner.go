@@ -0,0 +1,160 @@
+// Package partner resolves which partner (Intuit, TaxSlayer, ...) a
+// request comes from and carries it in the request context.
+package partner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/giact"
+	"github.com/dstroot/chi_api/logging"
+)
+
+// Partner is a company that integrates with our API.
+type Partner struct {
+	Name  string   `json:"name"`
+	Site  string   `json:"site"`            // URL of the partner's front-end
+	Years []string `json:"years,omitempty"` // system years the partner can see, empty for all
+
+	APIKeys []string      `json:"-"`
+	Giact   *giact.Client `json:"-"` // GIACT client with the partner's credentials
+}
+
+// CanSee reports whether a system year is within the partner's data scope.
+func (p *Partner) CanSee(year string) bool {
+	if len(p.Years) == 0 {
+		return true
+	}
+	for _, y := range p.Years {
+		if y == year {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry holds the configured partners.
+type Registry struct {
+	byName map[string]*Partner
+	byKey  map[string]*Partner
+}
+
+// NewRegistry returns a registry of the given partners.
+func NewRegistry(partners ...*Partner) *Registry {
+	reg := &Registry{
+		byName: make(map[string]*Partner),
+		byKey:  make(map[string]*Partner),
+	}
+	for _, p := range partners {
+		reg.byName[p.Name] = p
+		for _, key := range p.APIKeys {
+			reg.byKey[key] = p
+		}
+	}
+	return reg
+}
+
+// Get returns the partner with the given name.
+func (reg *Registry) Get(name string) (*Partner, bool) {
+	p, ok := reg.byName[strings.ToLower(name)]
+	return p, ok
+}
+
+// List returns all partners ordered by name.
+func (reg *Registry) List() []*Partner {
+	partners := make([]*Partner, 0, len(reg.byName))
+	for _, p := range reg.byName {
+		partners = append(partners, p)
+	}
+	sort.Slice(partners, func(i, j int) bool { return partners[i].Name < partners[j].Name })
+	return partners
+}
+
+// Verified returns the partner whose API key the authenticator
+// verified, the only one trusted with credentials and a data scope. It
+// must run after the authenticator.
+func (reg *Registry) Verified(r *http.Request) (*Partner, bool) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok || principal.Method != "api_key" || !principal.HasRole(auth.RolePartner) {
+		return nil, false
+	}
+	p, ok := reg.byKey[r.Header.Get("X-API-Key")]
+	if !ok || p.Name != principal.Subject {
+		return nil, false
+	}
+	return p, true
+}
+
+// Resolve finds the partner a request comes from. It looks at, in order,
+// the verified API key, the X-Partner header and the first label of the
+// host name (e.g. intuit.api.example.com). Anyone can send the header or
+// pick the host, so only use the partner to pick its site.
+func (reg *Registry) Resolve(r *http.Request) (*Partner, bool) {
+	if p, ok := reg.Verified(r); ok {
+		return p, true
+	}
+	if name := r.Header.Get("X-Partner"); name != "" {
+		return reg.Get(name)
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		return reg.Get(host[:i])
+	}
+	return nil, false
+}
+
+// Handler is a middleware that resolves the partner of each request
+// and stores it in the request context: the resolved partner for its
+// site, and the verified partner for its credentials and data scope.
+// Requests from unknown partners are passed on without one.
+func (reg *Registry) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if p, ok := reg.Resolve(r); ok {
+			logging.AddField(ctx, "partner", p.Name)
+			ctx = NewSiteContext(ctx, p)
+		}
+		if p, ok := reg.Verified(r); ok {
+			ctx = NewContext(ctx, p)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// key and siteKey are the context keys for the verified and the
+// resolved partner.
+type (
+	key     struct{}
+	siteKey struct{}
+)
+
+// NewContext returns a copy of ctx carrying the verified partner.
+func NewContext(ctx context.Context, p *Partner) context.Context {
+	return context.WithValue(ctx, key{}, p)
+}
+
+// FromContext returns the partner of a request, if it was verified by
+// its API key.
+func FromContext(ctx context.Context) (*Partner, bool) {
+	p, ok := ctx.Value(key{}).(*Partner)
+	return p, ok
+}
+
+// NewSiteContext returns a copy of ctx carrying the resolved partner.
+func NewSiteContext(ctx context.Context, p *Partner) context.Context {
+	return context.WithValue(ctx, siteKey{}, p)
+}
+
+// SiteFromContext returns the partner a request was resolved to, by
+// API key, header or host, whose site it should use.
+func SiteFromContext(ctx context.Context) (*Partner, bool) {
+	p, ok := ctx.Value(siteKey{}).(*Partner)
+	return p, ok
+}
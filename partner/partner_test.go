@@ -0,0 +1,93 @@
+package partner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dstroot/chi_api/auth"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolve(t *testing.T) {
+	Convey("Given registered partners", t, func() {
+		reg := NewRegistry(
+			&Partner{Name: "intuit", APIKeys: []string{"intuit-key"}},
+			&Partner{Name: "taxslayer", APIKeys: []string{"taxslayer-key"}, Years: []string{"2017"}},
+		)
+		authenticator := auth.New("test")
+		authenticator.AddAPIKey("intuit-key", "intuit", auth.RolePartner)
+		authenticator.AddAPIKey("taxslayer-key", "taxslayer", auth.RolePartner)
+		authenticator.AddAPIKey("admin-key", "ops", auth.RoleAdmin)
+
+		tests := []struct {
+			host, apiKey, header string
+			partner              string
+			verified             bool
+		}{
+			{"api.example.com", "intuit-key", "", "intuit", true},
+			{"api.example.com", "taxslayer-key", "intuit", "taxslayer", true},
+			{"api.example.com", "admin-key", "intuit", "intuit", false},
+			{"api.example.com", "", "TaxSlayer", "taxslayer", false},
+			{"api.example.com", "", "acme", "", false},
+			{"intuit.api.example.com:9102", "", "", "intuit", false},
+			{"localhost:9102", "", "", "", false},
+		}
+
+		for _, test := range tests {
+			r := httptest.NewRequest("GET", "/taxpro/2017/012345", nil)
+			r.Host = test.host
+			if test.apiKey != "" {
+				r.Header.Set("X-API-Key", test.apiKey)
+			}
+			if test.header != "" {
+				r.Header.Set("X-Partner", test.header)
+			}
+			if principal, err := authenticator.Authenticate(r); principal != nil && err == nil {
+				r = r.WithContext(auth.NewContext(r.Context(), principal))
+			}
+
+			p, ok := reg.Resolve(r)
+			So(ok, ShouldEqual, test.partner != "")
+			if ok {
+				So(p.Name, ShouldEqual, test.partner)
+			}
+			_, ok = reg.Verified(r)
+			So(ok, ShouldEqual, test.verified)
+		}
+
+		Convey("An API key that wasn't verified resolves no partner", func() {
+			r := httptest.NewRequest("GET", "/taxpro/2017/012345", nil)
+			r.Header.Set("X-API-Key", "intuit-key")
+			_, ok := reg.Resolve(r)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("The handler only carries a verified partner's credentials and scope", func() {
+			var site, verified *Partner
+			h := reg.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				site, _ = SiteFromContext(r.Context())
+				verified, _ = FromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "/taxpro/2017/012345", nil)
+			r.Header.Set("X-Partner", "taxslayer")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			So(site.Name, ShouldEqual, "taxslayer")
+			So(verified, ShouldBeNil)
+
+			r = httptest.NewRequest("GET", "/taxpro/2017/012345", nil)
+			r.Header.Set("X-API-Key", "intuit-key")
+			principal, _ := authenticator.Authenticate(r)
+			h.ServeHTTP(httptest.NewRecorder(), r.WithContext(auth.NewContext(r.Context(), principal)))
+			So(site.Name, ShouldEqual, "intuit")
+			So(verified.Name, ShouldEqual, "intuit")
+		})
+	})
+
+	Convey("A partner's data scope limits the years it can see", t, func() {
+		So((&Partner{}).CanSee("2015"), ShouldBeTrue)
+		So((&Partner{Years: []string{"2017"}}).CanSee("2017"), ShouldBeTrue)
+		So((&Partner{Years: []string{"2017"}}).CanSee("2015"), ShouldBeFalse)
+	})
+}
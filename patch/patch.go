@@ -0,0 +1,324 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents.
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Media types of patch documents.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrMalformed is returned for a patch that isn't valid JSON, or not
+// the shape its format requires.
+var ErrMalformed = errors.New("malformed patch")
+
+// ErrTestFailed is returned when a JSON Patch "test" operation fails.
+var ErrTestFailed = errors.New("patch test failed")
+
+// Merge applies a JSON Merge Patch to a document.
+func Merge(doc, patch []byte) ([]byte, error) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, errors.Wrap(ErrMalformed, err.Error())
+	}
+	var d interface{}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, errors.Wrap(err, "decoding document")
+	}
+	return json.Marshal(merge(d, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
+
+// Operation is a JSON Patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"` // empty when absent, "null" for null
+}
+
+// Apply applies a JSON Patch to a document. The operations are applied
+// in order and all or none take effect.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, errors.Wrap(ErrMalformed, err.Error())
+	}
+	var d interface{}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, errors.Wrap(err, "decoding document")
+	}
+
+	for i, op := range ops {
+		var err error
+		d, err = op.apply(d)
+		if err != nil {
+			if err == ErrTestFailed || errors.Cause(err) == ErrMalformed {
+				return nil, err
+			}
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(d)
+}
+
+func (op *Operation) value() (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, errors.Wrapf(ErrMalformed, "%s needs a value", op.Op)
+	}
+	var v interface{}
+	err := json.Unmarshal(op.Value, &v)
+	return v, err
+}
+
+func (op *Operation) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("can't move a value into itself")
+			}
+			doc, v, err = remove(doc, from)
+		} else {
+			v, err = get(doc, from)
+			v = clone(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "test":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(doc, path)
+		if err != nil || !reflect.DeepEqual(actual, v) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, errors.Wrapf(ErrMalformed, "unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, errors.Wrapf(ErrMalformed, "pointer %q must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// index parses an array index token. With end, "-" and len(a) are
+// allowed, for adding at the end.
+func index(token string, a []interface{}, end bool) (int, error) {
+	if end && token == "-" {
+		return len(a), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("bad array index %q", token)
+	}
+	if i > len(a) || (i == len(a) && !end) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[t]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := index(t, d, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = d[i]
+		default:
+			return nil, fmt.Errorf("can't index a scalar with %q", t)
+		}
+	}
+	return doc, nil
+}
+
+// add returns doc with v added at path.
+func add(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = v
+		return doc, nil
+	case []interface{}:
+		i, err := index(last, p, true)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, nil)
+		copy(p[i+1:], p[i:])
+		p[i] = v
+		return set(doc, path[:len(path)-1], p)
+	}
+	return nil, fmt.Errorf("can't add to a scalar at %q", last)
+}
+
+// set returns doc with the value at path, which must exist, replaced
+// by v. Arrays that grow or shrink are put back with it.
+func set(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = v
+	case []interface{}:
+		i, err := index(last, p, false)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = v
+	}
+	return doc, nil
+}
+
+// remove returns doc without the value at path, and that value.
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		v, ok := p[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("no member %q", last)
+		}
+		delete(p, last)
+		return doc, v, nil
+	case []interface{}:
+		i, err := index(last, p, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := p[i]
+		p = append(p[:i:i], p[i+1:]...)
+		doc, err = set(doc, path[:len(path)-1], p)
+		return doc, v, err
+	}
+	return nil, nil, fmt.Errorf("can't remove from a scalar at %q", last)
+}
+
+// clone deep copies a decoded JSON value.
+func clone(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = clone(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = clone(e)
+		}
+		return c
+	}
+	return v
+}
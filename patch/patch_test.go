@@ -0,0 +1,66 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMerge(t *testing.T) {
+	Convey("Merge patches follow RFC 7396", t, func() {
+		doc := `{"a":"b","c":{"d":"e","f":"g"}}`
+		out, err := Merge([]byte(doc), []byte(`{"a":"z","c":{"f":null},"h":[1]}`))
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `{"a":"z","c":{"d":"e"},"h":[1]}`)
+
+		_, err = Merge([]byte(doc), []byte(`{`))
+		So(errors.Cause(err), ShouldEqual, ErrMalformed)
+	})
+}
+
+func TestApply(t *testing.T) {
+	Convey("Given a document", t, func() {
+		doc := []byte(`{"foo":["bar","baz"],"a/b":1,"m~n":2}`)
+
+		tests := []struct {
+			name  string
+			patch string
+			want  string
+		}{
+			{"add to an object", `[{"op":"add","path":"/x","value":{"y":1}}]`, `{"a/b":1,"foo":["bar","baz"],"m~n":2,"x":{"y":1}}`},
+			{"add into an array", `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"a/b":1,"foo":["bar","qux","baz"],"m~n":2}`},
+			{"append to an array", `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"a/b":1,"foo":["bar","baz","qux"],"m~n":2}`},
+			{"remove escaped keys", `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/m~0n"}]`, `{"foo":["bar","baz"]}`},
+			{"replace", `[{"op":"replace","path":"/foo/0","value":"BAR"}]`, `{"a/b":1,"foo":["BAR","baz"],"m~n":2}`},
+			{"move", `[{"op":"move","from":"/foo/0","path":"/first"}]`, `{"a/b":1,"first":"bar","foo":["baz"],"m~n":2}`},
+			{"copy", `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"a/b":1,"bar":["bar","baz"],"foo":["bar","baz"],"m~n":2}`},
+			{"add a null", `[{"op":"add","path":"/x","value":null}]`, `{"a/b":1,"foo":["bar","baz"],"m~n":2,"x":null}`},
+			{"replace with null", `[{"op":"replace","path":"/a~1b","value":null}]`, `{"a/b":null,"foo":["bar","baz"],"m~n":2}`},
+			{"test a null", `[{"op":"add","path":"/x","value":null},{"op":"test","path":"/x","value":null}]`, `{"a/b":1,"foo":["bar","baz"],"m~n":2,"x":null}`},
+			{"test then replace", `[{"op":"test","path":"/a~1b","value":1},{"op":"replace","path":"/a~1b","value":3}]`, `{"a/b":3,"foo":["bar","baz"],"m~n":2}`},
+		}
+		for _, test := range tests {
+			test := test
+			Convey("It can "+test.name, func() {
+				out, err := Apply(doc, []byte(test.patch))
+				So(err, ShouldBeNil)
+				So(string(out), ShouldEqual, test.want)
+			})
+		}
+
+		Convey("A failed test fails the whole patch", func() {
+			_, err := Apply(doc, []byte(`[{"op":"remove","path":"/foo"},{"op":"test","path":"/a~1b","value":2}]`))
+			So(err, ShouldEqual, ErrTestFailed)
+		})
+
+		Convey("Missing paths and unknown ops are errors", func() {
+			_, err := Apply(doc, []byte(`[{"op":"remove","path":"/nope"}]`))
+			So(err, ShouldNotBeNil)
+			_, err = Apply(doc, []byte(`[{"op":"frobnicate","path":"/foo"}]`))
+			So(errors.Cause(err), ShouldEqual, ErrMalformed)
+			_, err = Apply(doc, []byte(`[{"op":"add","path":"/x"}]`))
+			So(errors.Cause(err), ShouldEqual, ErrMalformed)
+		})
+	})
+}
@@ -0,0 +1,162 @@
+// Package problem writes API errors as RFC 7807 problem details, so
+// every failure, whether from a handler, a middleware or a panic, has
+// the same application/problem+json shape.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/dstroot/chi_api/validation"
+	"github.com/pressly/chi/middleware"
+)
+
+// ContentType is the media type of a problem.
+const ContentType = "application/problem+json"
+
+// Codes for problems that aren't covered by their status alone.
+const (
+	CodeValidation = "validation_failed"
+	CodePanic      = "internal_panic"
+	CodeTimeout    = "request_timeout"
+
+	CodeQueryTimeout  = "query_timeout"
+	CodeQueryCanceled = "query_canceled"
+)
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+
+	// Code is a stable, machine readable error code.
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+
+	// RequestID correlates the problem with our logs.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Errors lists the invalid fields of a rejected request.
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// New returns a problem for a status. Its code is derived from the
+// status text, e.g. "not_found" for a 404.
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   Code(status),
+		Detail: detail,
+	}
+}
+
+// Code returns the default code of a status.
+func Code(status int) string {
+	text := strings.ToLower(http.StatusText(status))
+	if text == "" {
+		return "error"
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return '_'
+	}, text)
+}
+
+// Error returns the problem's detail so a Problem can be used as an error.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// Write writes a problem, stamped with the ID of the request.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Code == "" {
+		p.Code = Code(p.Status)
+	}
+	if r != nil && p.RequestID == "" {
+		p.RequestID = middleware.GetReqID(r.Context())
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Render writes a problem for a status.
+func Render(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// Invalid writes a problem listing the invalid fields of a request.
+func Invalid(w http.ResponseWriter, r *http.Request, status int, errs validation.Errors) {
+	p := New(status, "the request has invalid fields")
+	p.Code = CodeValidation
+	p.Errors = errs
+	Write(w, r, p)
+}
+
+// NotFound is a router's handler for unknown routes.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Render(w, r, http.StatusNotFound, "no such resource")
+}
+
+// MethodNotAllowed is a router's handler for unsupported methods.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Render(w, r, http.StatusMethodNotAllowed, r.Method+" is not supported here")
+}
+
+// Recoverer recovers from panics, logs them with a backtrace and
+// answers with a 500 problem, unless the response was already started.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				if logEntry := middleware.GetLogEntry(r); logEntry != nil {
+					logEntry.Panic(rvr, debug.Stack())
+				} else {
+					debug.PrintStack()
+				}
+
+				if ww.Status() == 0 {
+					p := New(http.StatusInternalServerError, "the server hit an unexpected error")
+					p.Code = CodePanic
+					Write(ww, r, p)
+				}
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// Timeout cancels the request context after a timeout and answers with
+// a 504 problem if the handler gave up without responding. Handlers
+// must watch ctx.Done() for the timeout to have any effect.
+func Timeout(timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if ctx.Err() == context.DeadlineExceeded && ww.Status() == 0 {
+				p := New(http.StatusGatewayTimeout, "the request took longer than "+timeout.String())
+				p.Code = CodeTimeout
+				Write(ww, r, p)
+			}
+		})
+	}
+}
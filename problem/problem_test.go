@@ -0,0 +1,82 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dstroot/chi_api/validation"
+	"github.com/pressly/chi/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func decode(w *httptest.ResponseRecorder) *Problem {
+	p := new(Problem)
+	So(json.Unmarshal(w.Body.Bytes(), p), ShouldBeNil)
+	return p
+}
+
+func TestProblem(t *testing.T) {
+	Convey("Given a request with an ID", t, func() {
+		var r *http.Request
+		middleware.RequestID(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			r = req
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		w := httptest.NewRecorder()
+
+		Convey("Render writes a problem with a code and the request ID", func() {
+			Render(w, r, http.StatusNotFound, "no article with id 7")
+
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+			So(w.Header().Get("Content-Type"), ShouldEqual, ContentType)
+			p := decode(w)
+			So(p.Status, ShouldEqual, http.StatusNotFound)
+			So(p.Code, ShouldEqual, "not_found")
+			So(p.Detail, ShouldEqual, "no article with id 7")
+			So(p.RequestID, ShouldNotBeEmpty)
+			So(p.RequestID, ShouldEqual, middleware.GetReqID(r.Context()))
+		})
+
+		Convey("Invalid lists the invalid fields", func() {
+			var errs validation.Errors
+			errs.Add("title", "is required")
+			Invalid(w, r, http.StatusUnprocessableEntity, errs)
+
+			p := decode(w)
+			So(p.Code, ShouldEqual, CodeValidation)
+			So(p.Errors, ShouldResemble, errs)
+		})
+	})
+
+	Convey("Recoverer answers a panic with a 500 problem", t, func() {
+		w := httptest.NewRecorder()
+		Recoverer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(decode(w).Code, ShouldEqual, CodePanic)
+	})
+
+	Convey("Timeout answers a handler that gave up with a 504 problem", t, func() {
+		w := httptest.NewRecorder()
+		Timeout(time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		So(w.Code, ShouldEqual, http.StatusGatewayTimeout)
+		So(decode(w).Code, ShouldEqual, CodeTimeout)
+	})
+
+	Convey("Timeout leaves a response that was already written alone", t, func() {
+		w := httptest.NewRecorder()
+		Timeout(time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			<-r.Context().Done()
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		So(w.Code, ShouldEqual, http.StatusAccepted)
+	})
+}
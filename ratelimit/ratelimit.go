@@ -0,0 +1,295 @@
+// Package ratelimit limits how fast each client may call us, with a
+// token bucket per client and route group. Limits can be set per
+// partner and per route group, and responses carry the RateLimit-*
+// quota headers so clients can pace themselves.
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/partner"
+	"github.com/dstroot/chi_api/problem"
+	"github.com/pkg/errors"
+)
+
+// Any matches every partner or route group in a limit's key.
+const Any = "*"
+
+// Limit allows Count requests per Period, all at once if need be.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseLimit parses a limit such as "100/m". The period is a unit, "s",
+// "m" or "h", or a duration such as "30s".
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, errors.Errorf("rate limit %q must look like 100/m", s)
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 {
+		return Limit{}, errors.Errorf("rate limit %q must allow at least one request", s)
+	}
+	var period time.Duration
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		period, err = time.ParseDuration(parts[1])
+		if err != nil || period <= 0 {
+			return Limit{}, errors.Errorf("rate limit %q has a bad period", s)
+		}
+	}
+	return Limit{Count: count, Period: period}, nil
+}
+
+func (l Limit) String() string {
+	period := l.Period.String()
+	switch l.Period {
+	case time.Second:
+		period = "s"
+	case time.Minute:
+		period = "m"
+	case time.Hour:
+		period = "h"
+	}
+	return strconv.Itoa(l.Count) + "/" + period
+}
+
+// perSecond returns the rate tokens come back at.
+func (l Limit) perSecond() float64 {
+	return float64(l.Count) / l.Period.Seconds()
+}
+
+// Limits maps "partner:group" keys to limits. Either part can be Any.
+type Limits map[string]Limit
+
+// ParseLimits parses definitions such as "intuit:verify=50/m". The
+// most specific limit applies: partner and group, then any partner in
+// the group, then the partner in any group, then "*:*".
+func ParseLimits(defs []string) (Limits, error) {
+	limits := make(Limits)
+	for _, def := range defs {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+		kv := strings.SplitN(def, "=", 2)
+		if len(kv) != 2 || strings.Count(kv[0], ":") != 1 {
+			return nil, errors.Errorf("rate limit %q must look like partner:group=100/m", def)
+		}
+		l, err := ParseLimit(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(kv[0])] = l
+	}
+	return limits, nil
+}
+
+// find returns the limit of a partner in a route group.
+func (limits Limits) find(partnerName, group string) (Limit, bool) {
+	for _, k := range []string{partnerName + ":" + group, Any + ":" + group, partnerName + ":" + Any, Any + ":" + Any} {
+		if l, ok := limits[k]; ok {
+			return l, true
+		}
+	}
+	return Limit{}, false
+}
+
+// MaxBuckets is how many clients a limiter tracks by default. Past it
+// the least recently used bucket is dropped, so a flood of addresses
+// can't exhaust our memory.
+const MaxBuckets = 100000
+
+// bucket holds a client's tokens in a route group.
+type bucket struct {
+	key    string
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the bucket was last used.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Count), b.tokens+now.Sub(b.last).Seconds()*b.limit.perSecond())
+	b.last = now
+}
+
+// Limiter hands out tokens. It's safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	limits  Limits
+	buckets map[string]*list.Element // client and group -> bucket
+	recent  *list.List               // buckets, most recently used first
+	max     int
+	swept   time.Time
+	now     func() time.Time
+}
+
+// New returns a limiter enforcing limits for at most MaxBuckets
+// clients at a time.
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		buckets: make(map[string]*list.Element),
+		recent:  list.New(),
+		max:     MaxBuckets,
+		now:     time.Now,
+	}
+}
+
+// SetLimits replaces the limits, e.g. when the configuration is
+// reloaded. Clients keep their tokens, up to their new limit.
+func (l *Limiter) SetLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Limit     Limit
+	Remaining int
+	Reset     time.Duration // until the bucket is full again
+	Allowed   bool
+	RetryIn   time.Duration // until a token is available, when not allowed
+}
+
+// Take takes a token for a client of a partner in a route group. ok is
+// false when no limit applies.
+func (l *Limiter) Take(client, partnerName, group string) (d Decision, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.limits.find(partnerName, group)
+	if !ok {
+		return d, false
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	key := client + "\xff" + group
+	var b *bucket
+	if e, ok := l.buckets[key]; ok {
+		b = e.Value.(*bucket)
+		l.recent.MoveToFront(e)
+	} else {
+		if l.recent.Len() >= l.max {
+			l.remove(l.recent.Back())
+		}
+		b = &bucket{key: key, limit: limit, tokens: float64(limit.Count), last: now}
+		l.buckets[key] = l.recent.PushFront(b)
+	}
+	b.refill(now)
+	if b.limit != limit {
+		b.limit = limit
+		b.tokens = math.Min(b.tokens, float64(limit.Count))
+	}
+
+	d.Limit = limit
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryIn = seconds((1 - b.tokens) / limit.perSecond())
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((float64(limit.Count) - b.tokens) / limit.perSecond())
+	return d, true
+}
+
+// sweep drops the buckets that have filled up again, at most once a
+// minute. Callers must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for e := l.recent.Front(); e != nil; {
+		next := e.Next()
+		b := e.Value.(*bucket)
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Count) {
+			l.remove(e)
+		}
+		e = next
+	}
+}
+
+// remove drops a bucket. Callers must hold l.mu.
+func (l *Limiter) remove(e *list.Element) {
+	delete(l.buckets, l.recent.Remove(e).(*bucket).key)
+}
+
+// seconds converts seconds to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Handler is a middleware limiting the requests of each client to a
+// route group. It must run after the authenticator and the partner
+// lookup.
+func (l *Limiter) Handler(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, partnerName := Client(r)
+			d, ok := l.Take(client, partnerName, group)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(d.Limit.Count))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(d.Reset))
+			if !d.Allowed {
+				h.Set("Retry-After", ceilSeconds(d.RetryIn))
+				problem.Render(w, r, http.StatusTooManyRequests, fmt.Sprintf("rate limit of %s exceeded", d.Limit))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Client identifies who a request counts against: the authenticated
+// caller, else its IP address. It also returns the partner whose
+// limits apply, which is only trusted when the request carried
+// credentials, so a bare X-Partner header can't borrow a partner's
+// quota.
+func Client(r *http.Request) (client, partnerName string) {
+	principal, authenticated := auth.FromContext(r.Context())
+	if !authenticated {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host, ""
+	}
+	if p, ok := partner.FromContext(r.Context()); ok {
+		partnerName = p.Name
+	}
+	return "subject:" + principal.Subject, partnerName
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dstroot/chi_api/auth"
+	"github.com/dstroot/chi_api/partner"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseLimits(t *testing.T) {
+	Convey("Limits are parsed and the most specific applies", t, func() {
+		limits, err := ParseLimits([]string{"*:*=100/m", "*:verify=10/m", "intuit:*=1000/h", "intuit:verify=5/30s"})
+		So(err, ShouldBeNil)
+
+		l, _ := limits.find("taxslayer", "taxpro")
+		So(l, ShouldResemble, Limit{100, time.Minute})
+		l, _ = limits.find("taxslayer", "verify")
+		So(l, ShouldResemble, Limit{10, time.Minute})
+		l, _ = limits.find("intuit", "taxpro")
+		So(l, ShouldResemble, Limit{1000, time.Hour})
+		l, _ = limits.find("intuit", "verify")
+		So(l, ShouldResemble, Limit{5, 30 * time.Second})
+
+		for _, bad := range []string{"*=1/m", "*:*=0/m", "*:*=1/fortnight", "*:*"} {
+			_, err := ParseLimits([]string{bad})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	Convey("Given a limit of 2 requests a minute", t, func() {
+		limiter := New(Limits{"*:*": {2, time.Minute}, "intuit:*": {3, time.Minute}})
+		now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		limiter.now = func() time.Time { return now }
+		h := limiter.Handler("taxpro")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		get := func(remoteAddr string, p *partner.Partner) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", "/taxpro/2017", nil)
+			r.RemoteAddr = remoteAddr
+			if p != nil {
+				r = r.WithContext(auth.NewContext(r.Context(), &auth.Principal{Subject: p.Name}))
+				r = r.WithContext(partner.NewContext(r.Context(), p))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+
+		Convey("Requests carry the quota headers", func() {
+			w := get("10.0.0.1:1234", nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("RateLimit-Limit"), ShouldEqual, "2")
+			So(w.Header().Get("RateLimit-Remaining"), ShouldEqual, "1")
+			So(w.Header().Get("RateLimit-Reset"), ShouldEqual, "30")
+		})
+
+		Convey("A client over its limit gets a 429 with Retry-After", func() {
+			get("10.0.0.1:1234", nil)
+			get("10.0.0.1:1234", nil)
+			w := get("10.0.0.1:5678", nil)
+			So(w.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(w.Header().Get("Retry-After"), ShouldEqual, "30")
+			So(w.Header().Get("RateLimit-Remaining"), ShouldEqual, "0")
+
+			Convey("without holding up other clients", func() {
+				So(get("10.0.0.2:1234", nil).Code, ShouldEqual, http.StatusOK)
+			})
+
+			Convey("until its tokens come back", func() {
+				now = now.Add(30 * time.Second)
+				So(get("10.0.0.1:1234", nil).Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Convey("Authenticated partners get their own limit", func() {
+			intuit := &partner.Partner{Name: "intuit"}
+			for i := 0; i < 3; i++ {
+				So(get("10.0.0.1:1234", intuit).Code, ShouldEqual, http.StatusOK)
+			}
+			So(get("10.0.0.1:1234", intuit).Code, ShouldEqual, http.StatusTooManyRequests)
+		})
+
+		Convey("The least recently used client is dropped past the cap", func() {
+			limiter.max = 2
+			get("10.0.0.1:1234", nil)
+			get("10.0.0.1:1234", nil)
+			get("10.0.0.2:1234", nil)
+			get("10.0.0.1:1234", nil)
+			get("10.0.0.3:1234", nil)
+			So(len(limiter.buckets), ShouldEqual, 2)
+			So(get("10.0.0.1:1234", nil).Code, ShouldEqual, http.StatusTooManyRequests)
+			So(get("10.0.0.2:1234", nil).Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("An unauthenticated partner header doesn't get its limit", func() {
+			r := httptest.NewRequest("GET", "/taxpro/2017", nil)
+			r = r.WithContext(partner.NewContext(r.Context(), &partner.Partner{Name: "intuit"}))
+			client, partnerName := Client(r)
+			So(client, ShouldEqual, "ip:192.0.2.1")
+			So(partnerName, ShouldEqual, "")
+		})
+	})
+}
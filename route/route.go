@@ -0,0 +1,35 @@
+// Package route reports the chi route that served a request, to label
+// metrics and log lines with it.
+package route
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pressly/chi"
+)
+
+// Pattern returns the pattern of the route that served a request, e.g.
+// /taxpro/:year/:efin, or "" before it's been routed.
+func Pattern(r *http.Request) string {
+	if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok && rctx != nil {
+		return joinPatterns(rctx.RoutePatterns)
+	}
+	return ""
+}
+
+// joinPatterns joins the patterns matched by nested routers into one,
+// e.g. "/taxpro/*" and "/:year/:efin" into "/taxpro/:year/:efin".
+func joinPatterns(patterns []string) string {
+	var joined string
+	for i, p := range patterns {
+		if i < len(patterns)-1 {
+			p = strings.TrimSuffix(p, "/*")
+		}
+		joined += p
+	}
+	if len(joined) > 1 {
+		joined = strings.TrimSuffix(joined, "/")
+	}
+	return joined
+}
@@ -0,0 +1,41 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pressly/chi"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPattern(t *testing.T) {
+	Convey("Given nested routers", t, func() {
+		var pattern string
+		record := func(w http.ResponseWriter, r *http.Request) { pattern = Pattern(r) }
+
+		r := chi.NewRouter()
+		r.Get("/", record)
+		r.Route("/taxpro", func(r chi.Router) {
+			r.Get("/:year/:efin", record)
+		})
+		r.Route("/articles/:articleID", func(r chi.Router) {
+			r.Get("/", record)
+		})
+		get := func(path string) string {
+			pattern = ""
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+			return pattern
+		}
+
+		Convey("The patterns of each router are joined", func() {
+			So(get("/taxpro/2017/012345"), ShouldEqual, "/taxpro/:year/:efin")
+			So(get("/articles/1"), ShouldEqual, "/articles/:articleID")
+			So(get("/"), ShouldEqual, "/")
+		})
+
+		Convey("A request that isn't routed has no pattern", func() {
+			So(Pattern(httptest.NewRequest("GET", "/", nil)), ShouldEqual, "")
+		})
+	})
+}
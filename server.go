@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dstroot/chi_api/database"
+	"github.com/dstroot/chi_api/problem"
+)
+
+// draining is set once we've been asked to shut down.
+var draining int32
+
+// heartbeat answers the load balancer's health checks on path. It
+// fails while we drain so no new traffic is sent our way.
+func heartbeat(path string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" || r.URL.Path != path {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if atomic.LoadInt32(&draining) == 1 {
+				problem.Render(w, r, http.StatusServiceUnavailable, "shutting down")
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("."))
+		})
+	}
+}
+
+// probe serves GET requests for path with h, ahead of the routes and
+// whatever middleware follows it, so the orchestrator's probes aren't
+// throttled, timed out or asked to authenticate.
+func probe(path string, h http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" || r.URL.Path != path {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h(w, r)
+		})
+	}
+}
+
+// newServer returns our HTTP server configured from cfg.
+func newServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           h,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+}
+
+// serve runs the server until SIGTERM or SIGINT, reloading our
+// configuration on SIGHUP. It then fails the health check for the
+// drain delay, stops accepting connections, waits for in-flight
+// requests up to the shutdown timeout and closes the database.
+func serve(srv *http.Server) error {
+	errc := make(chan error, 1)
+	go func() {
+		logger.Info("listening", "addr", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(stop)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+wait:
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-hup:
+			if err := reload(); err != nil {
+				logger.Error("reload failed", "error", err)
+			}
+		case sig := <-stop:
+			logger.Info("draining", "signal", sig, "delay", cfg.Server.DrainDelay)
+			break wait
+		}
+	}
+
+	atomic.StoreInt32(&draining, 1)
+	select {
+	case <-time.After(cfg.Server.DrainDelay):
+	case sig := <-stop:
+		logger.Warn("shutting down now", "signal", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		logger.Error("shutdown", "error", err)
+	}
+
+	if database.DB != nil {
+		if err1 := database.DB.Close(); err1 != nil {
+			logger.Error("closing database", "error", err1)
+		}
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeartbeat(t *testing.T) {
+	Convey("Given the heartbeat middleware", t, func() {
+		h := heartbeat("/health")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		defer atomic.StoreInt32(&draining, 0)
+
+		Convey("It answers the health check", func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("It fails the health check while draining", func() {
+			atomic.StoreInt32(&draining, 1)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+			So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/articles", nil))
+			So(w.Code, ShouldEqual, http.StatusTeapot)
+		})
+	})
+}
+
+func TestProbe(t *testing.T) {
+	Convey("Given a probe middleware", t, func() {
+		h := probe("/livez", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+		Convey("It answers GET requests for its path", func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("It passes other requests on", func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("POST", "/livez", nil))
+			So(w.Code, ShouldEqual, http.StatusTeapot)
+
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/articles", nil))
+			So(w.Code, ShouldEqual, http.StatusTeapot)
+		})
+	})
+}
@@ -0,0 +1,146 @@
+// Package tiering assigns tax professionals to partner tiers based on
+// their product volume. Tier thresholds come from configuration and can
+// be overridden per system year.
+package tiering
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Rule places a tax professional in a tier once their product
+// volume reaches MinVolume.
+type Rule struct {
+	Tier      string
+	MinVolume int
+}
+
+// String describes the rule, e.g. "Gold: product_count >= 250"
+func (rule Rule) String() string {
+	return fmt.Sprintf("%s: product_count >= %d", rule.Tier, rule.MinVolume)
+}
+
+// Rules is a set of tier rules ordered by ascending MinVolume.
+type Rules []Rule
+
+// ParseRules parses a space separated list of tier thresholds such
+// as "Bronze=0 Silver=100 Gold=250 Premier=500".
+func ParseRules(s string) (Rules, error) {
+	var rules Rules
+	for _, field := range strings.Fields(s) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid tier rule %q, expected Tier=MinVolume", field)
+		}
+		min, err := strconv.Atoi(parts[1])
+		if err != nil || min < 0 {
+			return nil, errors.Errorf("invalid minimum volume in tier rule %q", field)
+		}
+		rules = append(rules, Rule{Tier: parts[0], MinVolume: min})
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no tier rules")
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].MinVolume < rules[j].MinVolume })
+	return rules, nil
+}
+
+// ParseOverrides parses per-year tier rules separated by ";" such as
+// "2015:Bronze=0 Gold=200;2016:Bronze=0 Gold=225".
+func ParseOverrides(s string) (map[string]Rules, error) {
+	overrides := make(map[string]Rules)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid tier override %q, expected Year:Rules", entry)
+		}
+		year := strings.TrimSpace(parts[0])
+		rules, err := ParseRules(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "tier override for %s", year)
+		}
+		overrides[year] = rules
+	}
+	return overrides, nil
+}
+
+// Match is the outcome of evaluating a product volume.
+type Match struct {
+	Tier    string // name of the tier, empty if no rule matched
+	Rule    string // description of the rule that matched
+	Premier bool   // whether the tier counts as a premier partner
+}
+
+// Engine evaluates product volumes against the configured tier rules.
+type Engine struct {
+	Default     Rules
+	Years       map[string]Rules
+	PremierTier string // lowest tier that counts as a premier partner
+}
+
+// New returns an engine for the given default rules, per-year
+// overrides and premier partner tier. The premier tier must be one
+// of the tiers in every rule set.
+func New(rules Rules, years map[string]Rules, premierTier string) (*Engine, error) {
+	e := &Engine{Default: rules, Years: years, PremierTier: premierTier}
+	if e.Years == nil {
+		e.Years = make(map[string]Rules)
+	}
+	if _, ok := rules.min(premierTier); !ok {
+		return nil, errors.Errorf("premier tier %q is not a configured tier", premierTier)
+	}
+	for year, r := range e.Years {
+		if _, ok := r.min(premierTier); !ok {
+			return nil, errors.Errorf("premier tier %q is not configured for %s", premierTier, year)
+		}
+	}
+	return e, nil
+}
+
+// Rules returns the rules in force for a system year.
+func (e *Engine) Rules(year string) Rules {
+	if rules, ok := e.Years[year]; ok {
+		return rules
+	}
+	return e.Default
+}
+
+// Evaluate returns the highest tier whose threshold the volume reaches.
+func (e *Engine) Evaluate(year string, volume int) Match {
+	rules := e.Rules(year)
+
+	var m Match
+	for _, rule := range rules {
+		if volume < rule.MinVolume {
+			break
+		}
+		m.Tier = rule.Tier
+		m.Rule = rule.String()
+		if _, overridden := e.Years[year]; overridden {
+			m.Rule += " (" + year + ")"
+		}
+	}
+
+	if premierMin, ok := rules.min(e.PremierTier); ok {
+		m.Premier = volume >= premierMin
+	}
+	return m
+}
+
+// min returns the threshold of the named tier.
+func (rules Rules) min(tier string) (int, bool) {
+	for _, rule := range rules {
+		if rule.Tier == tier {
+			return rule.MinVolume, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package tiering
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvaluate(t *testing.T) {
+	Convey("Given the default tiers and an override for 2015", t, func() {
+		rules, err := ParseRules("Premier=500 Bronze=0 Silver=100 Gold=250")
+		So(err, ShouldBeNil)
+		overrides, err := ParseOverrides("2015:Bronze=0 Gold=200")
+		So(err, ShouldBeNil)
+		engine, err := New(rules, overrides, "Gold")
+		So(err, ShouldBeNil)
+
+		Convey("Volumes are placed in the highest tier they reach", func() {
+			tests := []struct {
+				year    string
+				volume  int
+				tier    string
+				premier bool
+			}{
+				{"2017", 0, "Bronze", false},
+				{"2017", 249, "Silver", false},
+				{"2017", 250, "Gold", true},
+				{"2017", 1000, "Premier", true},
+				{"2015", 200, "Gold", true},
+				{"2015", 1000, "Gold", true},
+			}
+			for _, test := range tests {
+				m := engine.Evaluate(test.year, test.volume)
+				So(m.Tier, ShouldEqual, test.tier)
+				So(m.Premier, ShouldEqual, test.premier)
+			}
+		})
+
+		Convey("The matching rule is reported", func() {
+			So(engine.Evaluate("2017", 300).Rule, ShouldEqual, "Gold: product_count >= 250")
+			So(engine.Evaluate("2015", 300).Rule, ShouldEqual, "Gold: product_count >= 200 (2015)")
+		})
+	})
+
+	Convey("Invalid configuration is rejected", t, func() {
+		_, err := ParseRules("Bronze")
+		So(err, ShouldNotBeNil)
+		_, err = ParseRules("Bronze=-1")
+		So(err, ShouldNotBeNil)
+		_, err = ParseOverrides("2015")
+		So(err, ShouldNotBeNil)
+
+		rules, _ := ParseRules("Bronze=0 Silver=100")
+		_, err = New(rules, nil, "Gold")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,132 @@
+// Package validation checks request input and reports field-level
+// errors that handlers can render back to the client.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field-level validation errors.
+type Errors []FieldError
+
+// Error implements the error interface.
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Field + ": " + e.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Add records an error for a field.
+func (errs *Errors) Add(field string, format string, args ...interface{}) {
+	*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns the errors as an error, or nil if there are none.
+func (errs Errors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// YearRange is the inclusive range of supported system years. A zero
+// Last means the current calendar year.
+type YearRange struct {
+	First int
+	Last  int
+}
+
+// Years is the range of system years accepted by Year. It is set from
+// our configuration at startup.
+var Years = YearRange{First: 2014}
+
+// last returns the last supported year.
+func (yr YearRange) last() int {
+	if yr.Last == 0 {
+		return time.Now().Year()
+	}
+	return yr.Last
+}
+
+var efinFormat = regexp.MustCompile(`^[0-9]{6}$`)
+
+// EFIN checks that efin is an Electronic Filing Identification Number,
+// i.e. exactly six digits. EFINs are strings so leading zeros are kept.
+func EFIN(errs *Errors, field string, efin string) {
+	if !efinFormat.MatchString(efin) {
+		errs.Add(field, "must be six digits")
+	}
+}
+
+// Year checks that year is a supported system year.
+func Year(errs *Errors, field string, year string) {
+	y, err := strconv.Atoi(year)
+	if err != nil || len(year) != 4 {
+		errs.Add(field, "must be a four digit year")
+		return
+	}
+	if y < Years.First || y > Years.last() {
+		errs.Add(field, "must be between %d and %d", Years.First, Years.last())
+	}
+}
+
+// Required checks that value is not blank.
+func Required(errs *Errors, field string, value string) {
+	if strings.TrimSpace(value) == "" {
+		errs.Add(field, "is required")
+	}
+}
+
+// MaxLength checks that value is at most max characters long.
+func MaxLength(errs *Errors, field string, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		errs.Add(field, "must be at most %d characters", max)
+	}
+}
+
+// OneOf checks that value is one of the allowed values.
+func OneOf(errs *Errors, field string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	errs.Add(field, "must be one of %s", strings.Join(allowed, ", "))
+}
+
+// Digits checks that value is between min and max digits long.
+func Digits(errs *Errors, field string, value string, min int, max int) {
+	if len(value) < min || len(value) > max || strings.Trim(value, "0123456789") != "" {
+		errs.Add(field, "must be %d to %d digits", min, max)
+	}
+}
+
+// RoutingNumber checks that value is a nine digit ABA routing number
+// with a valid check digit.
+func RoutingNumber(errs *Errors, field string, value string) {
+	if len(value) != 9 || strings.Trim(value, "0123456789") != "" {
+		errs.Add(field, "must be nine digits")
+		return
+	}
+	weights := [9]int{3, 7, 1, 3, 7, 1, 3, 7, 1}
+	sum := 0
+	for i, c := range value {
+		sum += int(c-'0') * weights[i]
+	}
+	if sum%10 != 0 {
+		errs.Add(field, "is not a valid routing number")
+	}
+}
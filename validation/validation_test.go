@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidation(t *testing.T) {
+	Convey("Given supported years 2014 to 2017", t, func() {
+		Years = YearRange{First: 2014, Last: 2017}
+
+		tests := []struct {
+			year, efin string
+			fields     []string
+		}{
+			{"2017", "012345", nil},
+			{"2014", "000001", nil},
+			{"2013", "012345", []string{"year"}},
+			{"2018", "012345", []string{"year"}},
+			{"17", "12345", []string{"year", "efin"}},
+			{"2017", "01234a", []string{"efin"}},
+			{"2017", "0123456", []string{"efin"}},
+		}
+
+		for _, test := range tests {
+			var errs Errors
+			Year(&errs, "year", test.year)
+			EFIN(&errs, "efin", test.efin)
+
+			fields := make([]string, 0)
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if test.fields == nil {
+				So(errs.Err(), ShouldBeNil)
+			} else {
+				So(fields, ShouldResemble, test.fields)
+			}
+		}
+	})
+
+	Convey("Errors describe every invalid field", t, func() {
+		var errs Errors
+		Required(&errs, "title", " ")
+		MaxLength(&errs, "title", "toolong", 3)
+		So(errs.Err(), ShouldNotBeNil)
+		So(errs.Error(), ShouldEqual, "validation failed: title: is required; title: must be at most 3 characters")
+	})
+}